@@ -0,0 +1,493 @@
+// Package client is a Go client for the HTTP API of the monitoring server.
+//
+// Example usage:
+//
+//	c, err := client.New("https://metrics.example.com",
+//	    client.WithSignKey("secret"),
+//	    client.WithTimeout(5*time.Second),
+//	    client.WithRetryPolicy(client.DefaultRetryPolicy),
+//	)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	value := 42.0
+//	err = c.UpdateBatch(ctx, []client.Metric{{ID: "Temperature", MType: client.Gauge, Value: &value}})
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/encryption"
+	"github.com/DenisPavlov/monitoring/internal/util"
+)
+
+// Metric is a gauge or counter metric of the server API.
+type Metric struct {
+	// ID is the name of the metric, optionally with labels, e.g. `DiskFree{mountpoint="/"}`.
+	ID string `json:"id"`
+	// MType is the metric type, Gauge or Counter.
+	MType string `json:"type"`
+	// Delta is the increment of a counter. Nil for gauges.
+	Delta *int64 `json:"delta,omitempty"`
+	// Value is the value of a gauge. Nil for counters.
+	Value *float64 `json:"value,omitempty"`
+}
+
+// Metric types.
+const (
+	// Gauge is the type of metrics holding the last Value.
+	Gauge = "gauge"
+	// Counter is the type of metrics summing the Delta of every update.
+	Counter = "counter"
+)
+
+// HTTP headers of the server API.
+const (
+	// SignatureHeader holds the hex HMAC-SHA256 signature of a request or response.
+	SignatureHeader = "HashSHA256"
+	// SignatureVersionHeader holds the signing scheme version of a request.
+	SignatureVersionHeader = "X-Signature-Version"
+	// SignatureTimestampHeader holds the unix time a request was signed at in seconds.
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	// SignatureNonceHeader holds a random value unique for every signed request.
+	SignatureNonceHeader = "X-Signature-Nonce"
+	// EncryptedKeyHeader holds the base64 payload key of an encrypted request body.
+	EncryptedKeyHeader = "X-Encrypted-Key"
+	// IdempotencyKeyHeader holds the key of a request applied at most once.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// AgentIDHeader holds the ID of the agent sending a batch.
+	AgentIDHeader = "X-Agent-ID"
+	// BatchSeqHeader holds the sequence number of a batch within its agent.
+	BatchSeqHeader = "X-Batch-Seq"
+)
+
+// maxErrorBodySize limits the part of an error response body kept in HTTPError.
+const maxErrorBodySize = 512
+
+// Client sends requests to a monitoring server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	retry      RetryPolicy
+	signKey    string
+	legacySign bool
+	compress   bool
+	publicKey  *rsa.PublicKey
+}
+
+// options holds the settings applied by New.
+type options struct {
+	httpClient *http.Client
+	tlsConfig  *tls.Config
+	timeout    time.Duration
+	retry      RetryPolicy
+	signKey    string
+	legacySign bool
+	compress   bool
+	publicKey  *rsa.PublicKey
+}
+
+// Option configures a Client in New.
+type Option func(*options)
+
+// WithHTTPClient sets the HTTP client used for requests. The client is copied,
+// so WithTimeout and WithTLSConfig do not change it. Default: a new http.Client.
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = c
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of https requests, e.g. a custom root
+// CA or a client certificate. The transport of the HTTP client must be an *http.Transport.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithTimeout limits every request attempt including reading the response.
+// Zero means no limit.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithRetryPolicy sets the retry policy. Default: no retries.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// WithSignKey signs requests and verifies the signatures of responses with
+// the key shared with the server. A response with a missing or wrong signature fails
+// with ErrSignatureMismatch. Default: no signing.
+func WithSignKey(key string) Option {
+	return func(o *options) {
+		o.signKey = key
+	}
+}
+
+// WithLegacySignature signs requests with version 1 of the signing scheme, which
+// covers the body only, for servers that do not support version 2. Version 1
+// signatures can be replayed, so use it only until the server is upgraded.
+func WithLegacySignature() Option {
+	return func(o *options) {
+		o.legacySign = true
+	}
+}
+
+// WithCompression enables or disables gzip compression of request bodies.
+// Default: enabled.
+func WithCompression(enabled bool) Option {
+	return func(o *options) {
+		o.compress = enabled
+	}
+}
+
+// WithEncryption encrypts request bodies with the RSA public key of the server:
+// every body is encrypted with a new AES-256-GCM key wrapped with RSA-OAEP.
+// Signatures and compression apply to the body before encryption. Default: no encryption.
+func WithEncryption(key *rsa.PublicKey) Option {
+	return func(o *options) {
+		o.publicKey = key
+	}
+}
+
+// New creates a client of the server at baseURL, e.g. "https://metrics.example.com"
+// or "localhost:8080". An address without a scheme uses http.
+//
+// Returns an error for an invalid URL or if TLS settings cannot be applied.
+func New(baseURL string, opts ...Option) (*Client, error) {
+	o := options{compress: true}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q: an http(s) URL with a host is required", baseURL)
+	}
+
+	httpClient := &http.Client{}
+	if o.httpClient != nil {
+		copied := *o.httpClient
+		httpClient = &copied
+	}
+	if o.timeout > 0 {
+		httpClient.Timeout = o.timeout
+	}
+	if o.tlsConfig != nil {
+		transport := http.DefaultTransport
+		if httpClient.Transport != nil {
+			transport = httpClient.Transport
+		}
+		t, ok := transport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("cannot set TLS config on transport %T", transport)
+		}
+		t = t.Clone()
+		t.TLSClientConfig = o.tlsConfig
+		httpClient.Transport = t
+	}
+
+	return &Client{
+		baseURL:    strings.TrimSuffix(u.String(), "/"),
+		httpClient: httpClient,
+		retry:      o.retry,
+		signKey:    o.signKey,
+		legacySign: o.legacySign,
+		compress:   o.compress,
+		publicKey:  o.publicKey,
+	}, nil
+}
+
+// RequestOption sets optional headers of a single request.
+type RequestOption func(*http.Request)
+
+// WithIdempotencyKey makes the server apply the request at most once and return
+// the original result for repeats with the same key.
+func WithIdempotencyKey(key string) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+}
+
+// WithBatchSequence identifies a batch by the sending agent and its sequence number,
+// so the server drops the batch if it was already applied.
+func WithBatchSequence(agentID string, seq uint64) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set(AgentIDHeader, agentID)
+		r.Header.Set(BatchSeqHeader, strconv.FormatUint(seq, 10))
+	}
+}
+
+// Update sends a single metric to POST /update/ and returns the metric as saved
+// by the server.
+//
+// If retries are enabled and no idempotency key is given, a random key is used,
+// so a counter is not incremented twice when a response is lost.
+func (c *Client) Update(ctx context.Context, m Metric, opts ...RequestOption) (Metric, error) {
+	var saved Metric
+	err := c.do(ctx, http.MethodPost, "/update/", m, &saved, c.retryKey(opts))
+	return saved, err
+}
+
+// UpdateBatch sends metrics to POST /updates/ in a single request.
+// A random idempotency key is used as in Update.
+func (c *Client) UpdateBatch(ctx context.Context, metrics []Metric, opts ...RequestOption) error {
+	return c.do(ctx, http.MethodPost, "/updates/", metrics, nil, c.retryKey(opts))
+}
+
+// retryKey prepends a random idempotency key to the request options if retries are
+// enabled. A key set by opts replaces it.
+func (c *Client) retryKey(opts []RequestOption) []RequestOption {
+	if c.retry.MaxAttempts < 2 {
+		return opts
+	}
+	return append([]RequestOption{WithIdempotencyKey(randomHex())}, opts...)
+}
+
+// randomHex returns 16 random bytes in hex.
+func randomHex() string {
+	b := make([]byte, 16)
+	_, _ = cryptorand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Get returns the metric of the given type and ID from POST /value/.
+// Returns an error matching ErrNotFound if the metric does not exist.
+func (c *Client) Get(ctx context.Context, mType, id string) (Metric, error) {
+	var m Metric
+	err := c.do(ctx, http.MethodPost, "/value/", Metric{ID: id, MType: mType}, &m, nil)
+	return m, err
+}
+
+// List returns all metrics from GET /value/.
+func (c *Client) List(ctx context.Context) ([]Metric, error) {
+	var metrics []Metric
+	err := c.do(ctx, http.MethodGet, "/value/", nil, &metrics, nil)
+	return metrics, err
+}
+
+// do sends a request with the JSON of in, retrying it according to the retry policy,
+// and decodes the JSON response into out unless out is nil.
+func (c *Client) do(ctx context.Context, method, path string, in, out any, opts []RequestOption) error {
+	var body, payload []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return err
+		}
+		var encryptedKey string
+		if payload, encryptedKey, err = c.encode(body); err != nil {
+			return err
+		}
+		if encryptedKey != "" {
+			opts = append([]RequestOption{withEncryptedKey(encryptedKey)}, opts...)
+		}
+	}
+
+	c.retry.Budget.deposit()
+	for attempt := 0; ; attempt++ {
+		status, respBody, header, sendErr := c.send(ctx, method, path, body, payload, opts)
+		err := sendErr
+		if err == nil {
+			respBody, err = c.check(status, header, respBody)
+		}
+		if err == nil {
+			if out == nil {
+				return nil
+			}
+			if err := json.Unmarshal(respBody, out); err != nil {
+				return fmt.Errorf("decode response: %w", err)
+			}
+			return nil
+		}
+
+		if attempt+1 >= c.retry.MaxAttempts || !retryable(ctx, status, sendErr) || !c.retry.Budget.withdraw() {
+			return err
+		}
+		delay := c.retry.delay(attempt)
+		if d, ok := retryAfter(header, time.Now()); ok {
+			delay = c.retry.clampDelay(d)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// check verifies the signature and the status of a response and returns the
+// uncompressed body. The signature covers the body as sent, i.e. before decompression.
+//
+// A signature mismatch of an error response also matches the HTTPError of its status.
+func (c *Client) check(status int, header http.Header, raw []byte) ([]byte, error) {
+	signErr := c.verify(header, raw)
+	body, err := decode(header, raw)
+	if err != nil {
+		if signErr != nil {
+			return nil, signErr
+		}
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	if status != http.StatusOK {
+		httpErr := &HTTPError{StatusCode: status, Body: truncate(body, maxErrorBodySize)}
+		if signErr != nil {
+			return nil, fmt.Errorf("%w: %w", signErr, httpErr)
+		}
+		return nil, httpErr
+	}
+	if signErr != nil {
+		return nil, signErr
+	}
+	return body, nil
+}
+
+// send performs a single attempt with a new request body and returns the status,
+// the response body as sent by the server and the response headers.
+func (c *Client) send(ctx context.Context, method, path string, body, payload []byte, opts []RequestOption) (int, []byte, http.Header, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if c.compress {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		if c.signKey != "" {
+			c.sign(req, body)
+		}
+	}
+	// Set explicitly, the header stops the transport from decompressing the response
+	// before its signature is verified.
+	req.Header.Set("Accept-Encoding", "gzip")
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("read response: %w", err)
+	}
+	return resp.StatusCode, respBody, resp.Header, nil
+}
+
+// sign sets the signature headers of a request with the uncompressed body. Every
+// attempt gets a new timestamp and nonce, so the server does not reject retries as replays.
+func (c *Client) sign(req *http.Request, body []byte) {
+	if c.legacySign {
+		req.Header.Set(SignatureHeader, util.GetHexSHA256(c.signKey, body))
+		return
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := randomHex()
+	req.Header.Set(SignatureVersionHeader, "2")
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureNonceHeader, nonce)
+	req.Header.Set(SignatureHeader, util.GetHexSHA256Request(c.signKey, req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+}
+
+// encode returns the request payload, gzip-compressed if compression is enabled and
+// then encrypted if a public key is set, with the base64 encrypted payload key.
+// Retries of a request send the same payload.
+func (c *Client) encode(body []byte) ([]byte, string, error) {
+	payload := body
+	if c.compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return nil, "", err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", err
+		}
+		payload = buf.Bytes()
+	}
+	if c.publicKey == nil {
+		return payload, "", nil
+	}
+	key, ciphertext, err := encryption.Encrypt(c.publicKey, payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("encrypt request: %w", err)
+	}
+	return ciphertext, base64.StdEncoding.EncodeToString(key), nil
+}
+
+// withEncryptedKey sets the encrypted payload key of a request.
+func withEncryptedKey(key string) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set(EncryptedKeyHeader, key)
+	}
+}
+
+// decode returns the response body, decompressed if it is gzip-encoded.
+func decode(header http.Header, raw []byte) ([]byte, error) {
+	if !strings.Contains(header.Get("Content-Encoding"), "gzip") {
+		return raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// verify checks the signature of a response when a sign key is set.
+// A missing signature is a mismatch, since the server signs every response.
+func (c *Client) verify(header http.Header, body []byte) error {
+	if c.signKey == "" {
+		return nil
+	}
+	sign := header.Get(SignatureHeader)
+	if sign == "" {
+		return fmt.Errorf("%w: no %s header", ErrSignatureMismatch, SignatureHeader)
+	}
+	if !hmac.Equal([]byte(sign), []byte(util.GetHexSHA256(c.signKey, body))) {
+		return ErrSignatureMismatch
+	}
+	return nil
+}
+
+// truncate returns at most n bytes of b as a string.
+func truncate(b []byte, n int) string {
+	if len(b) > n {
+		b = b[:n]
+	}
+	return strings.TrimSpace(string(b))
+}
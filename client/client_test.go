@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/handler"
+	"github.com/DenisPavlov/monitoring/internal/storage"
+	"github.com/DenisPavlov/monitoring/internal/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestClient_Endpoints(t *testing.T) {
+	srv := httptest.NewServer(handler.BuildRouter(storage.NewMemStorage(), nil, ""))
+	defer srv.Close()
+	c, err := New(srv.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	saved, err := c.Update(ctx, Metric{ID: "PollCount", MType: Counter, Delta: ptr(int64(2))})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *saved.Delta)
+
+	err = c.UpdateBatch(ctx, []Metric{
+		{ID: "PollCount", MType: Counter, Delta: ptr(int64(3))},
+		{ID: "Alloc", MType: Gauge, Value: ptr(1.5)},
+	}, WithIdempotencyKey("k1"), WithBatchSequence("agent", 1))
+	require.NoError(t, err)
+
+	m, err := c.Get(ctx, Counter, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), *m.Delta)
+
+	_, err = c.Get(ctx, Gauge, "Missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	all, err := c.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Metric{
+		{ID: "Alloc", MType: Gauge, Value: ptr(1.5)},
+		{ID: "PollCount", MType: Counter, Delta: ptr(int64(5))},
+	}, all)
+}
+
+func TestClient_Retry(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.NotEmpty(t, body, "the body is sent with every attempt")
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}))
+	require.NoError(t, err)
+	assert.NoError(t, c.UpdateBatch(context.Background(), []Metric{{ID: "a", MType: Gauge, Value: ptr(1.0)}}))
+	assert.Equal(t, int32(3), attempts.Load())
+
+	attempts.Store(0)
+	c, err = New(srv.URL)
+	require.NoError(t, err)
+	err = c.UpdateBatch(context.Background(), nil)
+	assert.ErrorIs(t, err, ErrUnavailable, "no retries by default")
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestClient_Signature(t *testing.T) {
+	const key = "secret"
+	respSign := util.GetHexSHA256(key, []byte("[]"))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SignatureHeader, respSign)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithSignKey(key))
+	require.NoError(t, err)
+	_, err = c.List(context.Background())
+	assert.NoError(t, err)
+
+	respSign = util.GetHexSHA256("other", []byte("[]"))
+	_, err = c.List(context.Background())
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+
+	respSign = ""
+	_, err = c.List(context.Background())
+	assert.ErrorIs(t, err, ErrSignatureMismatch, "a missing signature is a mismatch")
+}
+
+func TestClient_SignedResponse(t *testing.T) {
+	srv := httptest.NewServer(handler.BuildRouter(storage.NewMemStorage(), nil, "secret"))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithSignKey("secret"))
+	require.NoError(t, err)
+	require.NoError(t, c.UpdateBatch(context.Background(), []Metric{{ID: "a", MType: Gauge, Value: ptr(1.0)}}))
+	metrics, err := c.List(context.Background())
+	require.NoError(t, err, "the gzip-compressed response is verified")
+	assert.Len(t, metrics, 1)
+	_, err = c.Get(context.Background(), Gauge, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	c, err = New(srv.URL, WithSignKey("other"))
+	require.NoError(t, err)
+	_, err = c.List(context.Background())
+	assert.ErrorIs(t, err, ErrSignatureMismatch)
+}
+
+func TestClient_SignedRequest(t *testing.T) {
+	srv := httptest.NewServer(handler.BuildRouter(storage.NewMemStorage(), nil, "secret"))
+	defer srv.Close()
+
+	c, err := New(srv.URL, WithSignKey("secret"), WithCompression(false))
+	require.NoError(t, err)
+	assert.NoError(t, c.UpdateBatch(context.Background(), []Metric{{ID: "a", MType: Gauge, Value: ptr(1.0)}}))
+
+	c, err = New(srv.URL, WithSignKey("wrong"))
+	require.NoError(t, err)
+	err = c.UpdateBatch(context.Background(), []Metric{{ID: "a", MType: Gauge, Value: ptr(1.0)}})
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	c, err = New(srv.URL, WithSignKey("secret"), WithLegacySignature())
+	require.NoError(t, err)
+	err = c.UpdateBatch(context.Background(), []Metric{{ID: "a", MType: Gauge, Value: ptr(1.0)}})
+	assert.ErrorIs(t, err, ErrBadRequest, "version 1 signatures are rejected by default")
+
+	legacy := httptest.NewServer(handler.BuildRouter(storage.NewMemStorage(), nil, "secret", handler.WithLegacySignatures(true)))
+	defer legacy.Close()
+	c, err = New(legacy.URL, WithSignKey("secret"), WithLegacySignature())
+	require.NoError(t, err)
+	assert.NoError(t, c.UpdateBatch(context.Background(), []Metric{{ID: "a", MType: Gauge, Value: ptr(1.0)}}))
+}
+
+func TestClient_Encryption(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	var sawPlaintext atomic.Bool
+	router := handler.BuildRouter(storage.NewMemStorage(), nil, "secret", handler.WithPrivateKey(priv))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(EncryptedKeyHeader) == "" || bytes.Contains(body, []byte("Temperature")) {
+			sawPlaintext.Store(true)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		router.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	for _, compress := range []bool{true, false} {
+		c, err := New(srv.URL, WithSignKey("secret"), WithEncryption(&priv.PublicKey), WithCompression(compress))
+		require.NoError(t, err)
+		saved, err := c.Update(context.Background(), Metric{ID: "Temperature", MType: Gauge, Value: ptr(21.5)})
+		require.NoError(t, err, "compress: %v", compress)
+		assert.Equal(t, 21.5, *saved.Value)
+	}
+	assert.False(t, sawPlaintext.Load(), "request bodies are sent encrypted")
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	c, err := New(srv.URL, WithSignKey("secret"), WithEncryption(&other.PublicKey))
+	require.NoError(t, err)
+	err = c.UpdateBatch(context.Background(), []Metric{{ID: "Temperature", MType: Gauge, Value: ptr(1.0)}})
+	assert.ErrorIs(t, err, ErrBadRequest)
+}
+
+func TestClient_TLS(t *testing.T) {
+	srv := httptest.NewTLSServer(handler.BuildRouter(storage.NewMemStorage(), nil, ""))
+	defer srv.Close()
+
+	_, err := mustNew(t, srv.URL).List(context.Background())
+	assert.Error(t, err, "the test certificate is not trusted by default")
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	c, err := New(srv.URL, WithTLSConfig(&tls.Config{RootCAs: pool}), WithTimeout(time.Second))
+	require.NoError(t, err)
+	_, err = c.List(context.Background())
+	assert.NoError(t, err)
+}
+
+func TestNew(t *testing.T) {
+	c := mustNew(t, "localhost:8080/")
+	assert.Equal(t, "http://localhost:8080", c.baseURL)
+
+	_, err := New("ftp://localhost")
+	assert.Error(t, err)
+	_, err = New("http://")
+	assert.Error(t, err)
+
+	custom := &http.Client{Transport: roundTripperFunc(nil)}
+	_, err = New("localhost:8080", WithHTTPClient(custom), WithTLSConfig(&tls.Config{}))
+	assert.ErrorContains(t, err, "cannot set TLS config")
+}
+
+func TestHTTPError(t *testing.T) {
+	err := error(&HTTPError{StatusCode: http.StatusNotFound, Body: "not found"})
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrBadRequest))
+	assert.Equal(t, "unexpected response status 404 Not Found: not found", err.Error())
+}
+
+func TestHeadersMatchServer(t *testing.T) {
+	assert.Equal(t, handler.SHA256HeaderName, SignatureHeader)
+	assert.Equal(t, handler.SignatureVersionHeaderName, SignatureVersionHeader)
+	assert.Equal(t, handler.SignatureTimestampHeaderName, SignatureTimestampHeader)
+	assert.Equal(t, handler.SignatureNonceHeaderName, SignatureNonceHeader)
+	assert.Equal(t, handler.EncryptedKeyHeaderName, EncryptedKeyHeader)
+	assert.Equal(t, handler.IdempotencyKeyHeaderName, IdempotencyKeyHeader)
+	assert.Equal(t, handler.AgentIDHeaderName, AgentIDHeader)
+	assert.Equal(t, handler.BatchSeqHeaderName, BatchSeqHeader)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func mustNew(t *testing.T, baseURL string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(baseURL, opts...)
+	require.NoError(t, err)
+	return c
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is returned when the server responds with an unexpected status.
+//
+// It matches the sentinel errors below with errors.Is by status code:
+//
+//	if errors.Is(err, client.ErrNotFound) {
+//	    // the metric does not exist
+//	}
+type HTTPError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Body is the beginning of the response body.
+	Body string
+}
+
+// Error returns the status and the response body.
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("unexpected response status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Body != "" {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// Is reports whether target is an *HTTPError with the same status code.
+func (e *HTTPError) Is(target error) bool {
+	var t *HTTPError
+	return errors.As(target, &t) && t.StatusCode == e.StatusCode
+}
+
+// Sentinel errors for the statuses returned by the server.
+var (
+	// ErrBadRequest means the request or the metric was invalid.
+	ErrBadRequest = &HTTPError{StatusCode: http.StatusBadRequest}
+	// ErrNotFound means the metric does not exist.
+	ErrNotFound = &HTTPError{StatusCode: http.StatusNotFound}
+	// ErrConflict means the same batch or idempotency key is being applied by another request.
+	ErrConflict = &HTTPError{StatusCode: http.StatusConflict}
+	// ErrUnprocessable means the idempotency key was used for a different request.
+	ErrUnprocessable = &HTTPError{StatusCode: http.StatusUnprocessableEntity}
+	// ErrInternal means the server failed to process the request.
+	ErrInternal = &HTTPError{StatusCode: http.StatusInternalServerError}
+	// ErrUnavailable means the server is temporarily unavailable.
+	ErrUnavailable = &HTTPError{StatusCode: http.StatusServiceUnavailable}
+)
+
+// ErrSignatureMismatch is returned when the signature of a response is missing or
+// does not match its body, i.e. the response was altered or signed with another key.
+var ErrSignatureMismatch = errors.New("response signature mismatch")
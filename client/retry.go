@@ -0,0 +1,150 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy defines when and how often a failed request is repeated.
+// The zero value disables retries.
+//
+// Connection errors and 429 and 5xx responses are retried. The delay before a retry
+// is chosen at random between zero and BaseDelay*2^retry capped at MaxDelay (full
+// jitter), so clients failing at the same time do not retry in lockstep. A Retry-After
+// header of the response replaces the random delay, capped at MaxDelay as well.
+// No retry is made if the delay would exceed the deadline of the request context.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts including the first one.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// BaseDelay is the upper bound of the delay before the first retry.
+	// It doubles with every retry.
+	BaseDelay time.Duration
+
+	// MaxDelay limits the upper bound of the delay between retries. Zero means no limit.
+	MaxDelay time.Duration
+
+	// Budget limits the retries of all requests sharing it. Nil means no limit.
+	Budget *RetryBudget
+}
+
+// DefaultRetryPolicy retries three times with delays of up to 1, 2 and 4 seconds.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+// delay returns a random delay before the given retry, counted from 0.
+func (p RetryPolicy) delay(retry int) time.Duration {
+	d := p.BaseDelay << min(retry, 30)
+	if d < p.BaseDelay || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return rand.N(d + 1)
+}
+
+// clampDelay limits a delay requested by the server to MaxDelay.
+func (p RetryPolicy) clampDelay(d time.Duration) time.Duration {
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// RetryBudget limits retries to a fraction of requests, so a failing server is not
+// overloaded by retries of many concurrent requests.
+//
+// Every request adds ratio tokens to the budget, up to max, and every retry takes
+// one token. Retries stop when less than one token is left. The budget starts full,
+// allowing a burst of max retries. RetryBudget is safe for concurrent use.
+type RetryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	max    float64
+	ratio  float64
+}
+
+// NewRetryBudget creates a budget allowing retries of ratio of requests, e.g. 0.1 for
+// 10%, with a burst of max retries.
+func NewRetryBudget(ratio, max float64) *RetryBudget {
+	return &RetryBudget{tokens: max, max: max, ratio: ratio}
+}
+
+// deposit records a new request.
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, b.max)
+}
+
+// withdraw takes a token for a retry and reports whether the retry is allowed.
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// retryable reports whether a request that failed with err or the response status
+// should be repeated. Connection errors and 429 and 5xx responses are retried,
+// except 501 Not Implemented; nothing is retried once ctx is done.
+func retryable(ctx context.Context, status int, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return status == http.StatusTooManyRequests ||
+		(status >= http.StatusInternalServerError && status != http.StatusNotImplemented)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+// It returns false if the header is missing or invalid.
+func retryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// errDeadline is returned by sleep when the delay would exceed the context deadline.
+var errDeadline = errors.New("retry delay exceeds the context deadline")
+
+// sleep waits for d or until ctx is done. It fails immediately if the context
+// deadline is earlier than the end of the delay.
+func sleep(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < d {
+		return errDeadline
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for range 100 {
+		assert.LessOrEqual(t, p.delay(0), 100*time.Millisecond)
+		assert.LessOrEqual(t, p.delay(2), 400*time.Millisecond)
+		assert.LessOrEqual(t, p.delay(40), time.Second, "the delay is capped")
+		assert.GreaterOrEqual(t, p.delay(40), time.Duration(0))
+	}
+	assert.Zero(t, RetryPolicy{}.delay(3))
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := http.Header{}
+
+	_, ok := retryAfter(header, now)
+	assert.False(t, ok)
+
+	header.Set("Retry-After", "3")
+	d, ok := retryAfter(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, d)
+
+	header.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	d, ok = retryAfter(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+
+	header.Set("Retry-After", "soon")
+	_, ok = retryAfter(header, now)
+	assert.False(t, ok)
+}
+
+func TestRetryable(t *testing.T) {
+	ctx := context.Background()
+	assert.True(t, retryable(ctx, 0, errors.New("connection refused")))
+	assert.True(t, retryable(ctx, http.StatusTooManyRequests, nil))
+	assert.True(t, retryable(ctx, http.StatusInternalServerError, nil))
+	assert.False(t, retryable(ctx, http.StatusNotImplemented, nil))
+	assert.False(t, retryable(ctx, http.StatusBadRequest, nil))
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.False(t, retryable(canceled, 0, context.Canceled))
+}
+
+func TestRetryBudget(t *testing.T) {
+	b := NewRetryBudget(0.5, 2)
+	assert.True(t, b.withdraw())
+	assert.True(t, b.withdraw())
+	assert.False(t, b.withdraw(), "the burst is spent")
+	b.deposit()
+	assert.False(t, b.withdraw())
+	b.deposit()
+	assert.True(t, b.withdraw(), "every second request allows a retry")
+
+	var unlimited *RetryBudget
+	unlimited.deposit()
+	assert.True(t, unlimited.withdraw())
+}
+
+// flakyServer fails the first failures requests with status and records the idempotency keys.
+type flakyServer struct {
+	mu       sync.Mutex
+	failures int
+	status   int
+	header   http.Header
+	keys     []string
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, r.Header.Get(IdempotencyKeyHeader))
+	if len(s.keys) <= s.failures {
+		for k, v := range s.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(s.status)
+	}
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	flaky := &flakyServer{failures: 2, status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"0"}}}
+	srv := httptest.NewServer(flaky)
+	defer srv.Close()
+
+	c := mustNew(t, srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}))
+	start := time.Now()
+	require.NoError(t, c.UpdateBatch(context.Background(), nil))
+	assert.Less(t, time.Since(start), time.Second, "Retry-After replaces the backoff delay")
+	assert.Len(t, flaky.keys, 3)
+	assert.NotEmpty(t, flaky.keys[0], "a key is generated when retries are enabled")
+	assert.Equal(t, flaky.keys[0], flaky.keys[2], "the key is kept across attempts")
+}
+
+func TestClient_RetryAfterCapped(t *testing.T) {
+	flaky := &flakyServer{failures: 1, status: http.StatusServiceUnavailable, header: http.Header{"Retry-After": {"86400"}}}
+	srv := httptest.NewServer(flaky)
+	defer srv.Close()
+
+	c := mustNew(t, srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, MaxDelay: 10 * time.Millisecond}))
+	start := time.Now()
+	require.NoError(t, c.UpdateBatch(context.Background(), nil))
+	assert.Less(t, time.Since(start), time.Second, "Retry-After is capped at MaxDelay")
+	assert.Len(t, flaky.keys, 2)
+}
+
+func TestClient_RetryDeadline(t *testing.T) {
+	flaky := &flakyServer{failures: 10, status: http.StatusInternalServerError}
+	srv := httptest.NewServer(flaky)
+	defer srv.Close()
+
+	c := mustNew(t, srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := c.UpdateBatch(ctx, nil, WithIdempotencyKey("k1"))
+	assert.ErrorIs(t, err, ErrInternal, "the last error is returned")
+	assert.Less(t, time.Since(start), time.Second)
+	assert.LessOrEqual(t, len(flaky.keys), 2)
+	assert.Equal(t, "k1", flaky.keys[0], "an explicit key replaces the generated one")
+}
+
+func TestClient_RetryConnectionError(t *testing.T) {
+	var attempts int
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	srv := httptest.NewServer(&flakyServer{})
+	defer srv.Close()
+
+	c := mustNew(t, srv.URL,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	assert.NoError(t, c.UpdateBatch(context.Background(), nil))
+	assert.Equal(t, 2, attempts)
+}
+
+func TestClient_RetryBudget(t *testing.T) {
+	flaky := &flakyServer{failures: 100, status: http.StatusBadGateway}
+	srv := httptest.NewServer(flaky)
+	defer srv.Close()
+
+	budget := NewRetryBudget(0, 1)
+	c := mustNew(t, srv.URL, WithRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, Budget: budget}))
+	assert.ErrorIs(t, c.UpdateBatch(context.Background(), nil), &HTTPError{StatusCode: http.StatusBadGateway})
+	assert.ErrorIs(t, c.UpdateBatch(context.Background(), nil), &HTTPError{StatusCode: http.StatusBadGateway})
+	assert.Len(t, flaky.keys, 3, "only one retry is allowed by the budget")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/cmd/agent/config"
+	"github.com/DenisPavlov/monitoring/internal/service"
+)
+
+// Config file keys of the collectors registered once per configured item.
+const (
+	// execCollectorName is the exec collector. Every script is registered as
+	// a separate collector named "exec/<script>".
+	execCollectorName = "exec"
+
+	// scrapeCollectorName is the scrape collector. Every target is registered as
+	// a separate collector named "scrape/<target>".
+	scrapeCollectorName = "scrape"
+)
+
+// availableCollectors returns all collectors the agent can run, including the
+// upstream reporting the state of the servers.
+// New collectors are added here; the agent main loop does not need to change.
+//
+// Returns an error if a collector cannot restore its saved state.
+func availableCollectors(upstream metrics.Collector) ([]metrics.Collector, error) {
+	logTail, err := newLogTailCollector(config.Collectors["logtail"])
+	if err != nil {
+		return nil, err
+	}
+	return []metrics.Collector{
+		metrics.NewRuntimeCollector(),
+		metrics.NewSystemCollector(),
+		metrics.NewCPUCollector(),
+		newDiskCollector(config.Collectors["disk"]),
+		newNetworkCollector(config.Collectors["network"]),
+		newProcessCollector(config.Collectors["process"]),
+		metrics.NewCgroupCollector(config.Collectors["cgroup"].CgroupRoot, config.Collectors["cgroup"].Cgroups),
+		metrics.NewTextfileCollector(config.Collectors["textfile"].Directory),
+		newProbeCollector(config.Collectors["probe"]),
+		logTail,
+		metrics.NewPollCountCollector(),
+		upstream,
+	}, nil
+}
+
+// buildRegistry validates the collector configuration and registers all
+// enabled collectors with their poll intervals, timeouts and filters.
+func buildRegistry(upstream metrics.Collector) (*metrics.Registry, error) {
+	collectors, err := availableCollectors(upstream)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(collectors)+2)
+	for _, c := range collectors {
+		names = append(names, c.Name())
+	}
+	names = append(names, execCollectorName, scrapeCollectorName)
+	if err := config.ValidateCollectors(names); err != nil {
+		return nil, err
+	}
+
+	registry := metrics.NewRegistry(metrics.Relabeler{Rename: config.Rename, Labels: config.Labels})
+	for _, c := range collectors {
+		cfg := config.Collectors[c.Name()]
+		if !cfg.IsEnabled() {
+			log.Printf("Collector %s is disabled", c.Name())
+			continue
+		}
+		err := registry.Register(c, metrics.CollectorOptions{
+			Interval: time.Duration(config.CollectorPollInterval(c.Name())) * time.Second,
+			Timeout:  time.Duration(cfg.Timeout) * time.Second,
+			Filter:   metrics.Filter{Include: cfg.Include, Exclude: cfg.Exclude},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := registerScripts(registry); err != nil {
+		return nil, err
+	}
+	if err := registerScrapeTargets(registry); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// registerScripts registers a collector for every script of the exec collector.
+// Scripts use their own interval and timeout and fall back to the exec collector settings.
+func registerScripts(registry *metrics.Registry) error {
+	cfg := config.Collectors[execCollectorName]
+	if !cfg.IsEnabled() {
+		return nil
+	}
+	for _, sc := range cfg.Scripts {
+		interval := sc.Interval
+		if interval == 0 {
+			interval = config.CollectorPollInterval(execCollectorName)
+		}
+		timeout := sc.Timeout
+		if timeout == 0 {
+			timeout = cfg.Timeout
+		}
+		c := metrics.NewExecCollector(execCollectorName+"/"+sc.Name, sc.Command, sc.Format)
+		err := registry.Register(c, metrics.CollectorOptions{
+			Interval: time.Duration(interval) * time.Second,
+			Timeout:  time.Duration(timeout) * time.Second,
+			Filter:   metrics.Filter{Include: cfg.Include, Exclude: cfg.Exclude},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerScrapeTargets registers a collector for every target of the scrape collector.
+// Targets are scraped on the poll interval of the scrape collector.
+func registerScrapeTargets(registry *metrics.Registry) error {
+	cfg := config.Collectors[scrapeCollectorName]
+	if !cfg.IsEnabled() {
+		return nil
+	}
+	for _, t := range cfg.Targets {
+		c := metrics.NewScrapeCollector(scrapeCollectorName+"/"+t.Name, t.Name, t.URL)
+		err := registry.Register(c, metrics.CollectorOptions{
+			Interval: time.Duration(config.CollectorPollInterval(scrapeCollectorName)) * time.Second,
+			Timeout:  time.Duration(cfg.Timeout) * time.Second,
+			Filter:   metrics.Filter{Include: cfg.Include, Exclude: cfg.Exclude},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDiskCollector creates the disk collector with the mount point and
+// filesystem type filters from the config file.
+func newDiskCollector(cfg config.CollectorConfig) *metrics.DiskCollector {
+	return metrics.NewDiskCollector(
+		metrics.Filter{Include: cfg.Mountpoints.Include, Exclude: cfg.Mountpoints.Exclude},
+		metrics.Filter{Include: cfg.FSTypes.Include, Exclude: cfg.FSTypes.Exclude},
+	)
+}
+
+// newNetworkCollector creates the network collector with the interface filter
+// from the config file.
+func newNetworkCollector(cfg config.CollectorConfig) *metrics.NetworkCollector {
+	return metrics.NewNetworkCollector(metrics.Filter{Include: cfg.Interfaces.Include, Exclude: cfg.Interfaces.Exclude})
+}
+
+// newProcessCollector creates the process collector with the process groups
+// from the config file. The regular expressions are checked by config.Validate.
+func newProcessCollector(cfg config.CollectorConfig) *metrics.ProcessCollector {
+	groups := make([]metrics.ProcessGroup, 0, len(cfg.Processes))
+	for _, p := range cfg.Processes {
+		g := metrics.ProcessGroup{Name: p.Group, Pidfile: p.Pidfile}
+		if p.Name != "" {
+			g.NameRegexp = regexp.MustCompile(p.Name)
+		}
+		if p.Cmdline != "" {
+			g.CmdlineRegexp = regexp.MustCompile(p.Cmdline)
+		}
+		groups = append(groups, g)
+	}
+	return metrics.NewProcessCollector(groups)
+}
+
+// newProbeCollector creates the probe collector with the probes from the config file.
+func newProbeCollector(cfg config.CollectorConfig) *metrics.ProbeCollector {
+	probes := make([]metrics.Probe, 0, len(cfg.Probes))
+	for _, p := range cfg.Probes {
+		probes = append(probes, metrics.Probe{
+			Name:    p.Name,
+			URL:     p.URL,
+			Address: p.Address,
+			Timeout: time.Duration(p.Timeout) * time.Second,
+		})
+	}
+	return metrics.NewProbeCollector(probes)
+}
+
+// newLogTailCollector creates the logtail collector with the log files and the
+// state file from the config file. The regular expressions are checked by config.Validate.
+func newLogTailCollector(cfg config.CollectorConfig) (*metrics.LogTailCollector, error) {
+	files := make([]metrics.LogFile, 0, len(cfg.Logs))
+	for _, l := range cfg.Logs {
+		f := metrics.LogFile{Path: l.Path}
+		for _, p := range l.Patterns {
+			f.Patterns = append(f.Patterns, metrics.LogPattern{
+				Name:       p.Name,
+				Regexp:     regexp.MustCompile(p.Regexp),
+				ValueGroup: p.Value,
+			})
+		}
+		files = append(files, f)
+	}
+	return metrics.NewLogTailCollector(files, cfg.StateFile)
+}
@@ -0,0 +1,567 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/DenisPavlov/monitoring/internal/client"
+	"github.com/DenisPavlov/monitoring/internal/service"
+	"github.com/DenisPavlov/monitoring/internal/util"
+)
+
+// labelNameRe matches valid label names.
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// CollectorConfig holds the settings of a single collector.
+type CollectorConfig struct {
+	// Enabled turns the collector on or off. Collectors are enabled by default.
+	Enabled *bool `json:"enabled" yaml:"enabled"`
+
+	// PollInterval is the collector poll interval in seconds.
+	// Zero means the global poll interval (FlagPollInterval).
+	PollInterval int `json:"poll_interval" yaml:"poll_interval"`
+
+	// Timeout limits a single collection in seconds. Zero means the poll interval.
+	Timeout int `json:"timeout" yaml:"timeout"`
+
+	// Include lists glob patterns of metric names to report. Empty means all.
+	Include []string `json:"include" yaml:"include"`
+
+	// Exclude lists glob patterns of metric names to drop.
+	Exclude []string `json:"exclude" yaml:"exclude"`
+
+	// Mountpoints selects the filesystems reported by the disk collector by mount point.
+	Mountpoints PatternFilter `json:"mountpoints" yaml:"mountpoints"`
+
+	// FSTypes selects the filesystems reported by the disk collector by filesystem type.
+	FSTypes PatternFilter `json:"fstypes" yaml:"fstypes"`
+
+	// Interfaces selects the interfaces reported by the network collector by name.
+	Interfaces PatternFilter `json:"interfaces" yaml:"interfaces"`
+
+	// Processes lists the process groups reported by the process collector.
+	Processes []ProcessMatch `json:"processes" yaml:"processes"`
+
+	// CgroupRoot is the cgroup v2 mount point used by the cgroup collector.
+	// Empty means /sys/fs/cgroup.
+	CgroupRoot string `json:"cgroup_root" yaml:"cgroup_root"`
+
+	// Cgroups lists the cgroup paths reported by the cgroup collector relative to
+	// CgroupRoot. Empty means the cgroup of the agent.
+	Cgroups []string `json:"cgroups" yaml:"cgroups"`
+
+	// Directory is the directory scanned by the textfile collector for *.prom and *.json files.
+	Directory string `json:"directory" yaml:"directory"`
+
+	// Scripts lists the commands run by the exec collector.
+	Scripts []ScriptConfig `json:"scripts" yaml:"scripts"`
+
+	// Targets lists the Prometheus endpoints scraped by the scrape collector.
+	Targets []ScrapeTarget `json:"targets" yaml:"targets"`
+
+	// Probes lists the checks run by the probe collector.
+	Probes []ProbeTarget `json:"probes" yaml:"probes"`
+
+	// Logs lists the files followed by the logtail collector.
+	Logs []LogConfig `json:"logs" yaml:"logs"`
+
+	// StateFile is the file where the logtail collector saves its read offsets
+	// between restarts. Empty disables saving.
+	StateFile string `json:"state_file" yaml:"state_file"`
+}
+
+// LogConfig describes a log file followed by the logtail collector.
+type LogConfig struct {
+	// Path is the path to the log file.
+	Path string `json:"path" yaml:"path"`
+
+	// Patterns are matched against every new line of the file.
+	Patterns []LogPatternConfig `json:"patterns" yaml:"patterns"`
+}
+
+// LogPatternConfig describes a pattern counted by the logtail collector.
+type LogPatternConfig struct {
+	// Name identifies the pattern in the pattern label.
+	Name string `json:"name" yaml:"name"`
+
+	// Regexp is the regular expression matched against every line.
+	Regexp string `json:"regexp" yaml:"regexp"`
+
+	// Value is the name of a capture group of Regexp whose number is reported
+	// as a gauge. Empty means the pattern is only counted.
+	Value string `json:"value" yaml:"value"`
+}
+
+// ProbeTarget describes an HTTP or TCP check of the probe collector.
+// Exactly one of URL and Address must be set.
+type ProbeTarget struct {
+	// Name identifies the check in the probe label.
+	Name string `json:"name" yaml:"name"`
+
+	// URL is checked with an HTTP GET request.
+	URL string `json:"url" yaml:"url"`
+
+	// Address is checked by opening a TCP connection, e.g. "localhost:5432".
+	Address string `json:"address" yaml:"address"`
+
+	// Timeout limits the check in seconds. Zero means 5 seconds.
+	// It should be shorter than the timeout of the probe collector itself,
+	// which defaults to its poll interval.
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// ScrapeTarget describes an HTTP endpoint in the Prometheus text format.
+// Every target is polled as a separate collector named "scrape/<name>".
+type ScrapeTarget struct {
+	// Name identifies the target in the collector name and in the target label.
+	Name string `json:"name" yaml:"name"`
+
+	// URL is the endpoint address, e.g. "http://localhost:9100/metrics".
+	URL string `json:"url" yaml:"url"`
+}
+
+// ScriptConfig describes a command run by the exec collector.
+// Every script is polled as a separate collector named "exec/<name>".
+type ScriptConfig struct {
+	// Name identifies the script in the collector name and in error counters.
+	Name string `json:"name" yaml:"name"`
+
+	// Command is the executable and its arguments. It is not run through a shell.
+	Command []string `json:"command" yaml:"command"`
+
+	// Format is the output format: "text" (default) or "json".
+	Format string `json:"format" yaml:"format"`
+
+	// Interval is the script run interval in seconds.
+	// Zero means the poll interval of the exec collector.
+	Interval int `json:"interval" yaml:"interval"`
+
+	// Timeout limits a single run in seconds. Zero means the exec collector timeout.
+	Timeout int `json:"timeout" yaml:"timeout"`
+}
+
+// ProcessMatch selects the processes of a single group of the process collector.
+// A process matches by pidfile or by all of the set regular expressions.
+type ProcessMatch struct {
+	// Group is the name of the group reported in the group label.
+	Group string `json:"group" yaml:"group"`
+
+	// Name is a regular expression matched against the process name.
+	Name string `json:"name" yaml:"name"`
+
+	// Cmdline is a regular expression matched against the full command line.
+	Cmdline string `json:"cmdline" yaml:"cmdline"`
+
+	// Pidfile is the path to a file containing the process PID.
+	Pidfile string `json:"pidfile" yaml:"pidfile"`
+}
+
+// PatternFilter selects values with glob patterns in the path.Match syntax.
+type PatternFilter struct {
+	// Include lists patterns of values to keep. Empty means all values.
+	Include []string `json:"include" yaml:"include"`
+
+	// Exclude lists patterns of values to drop.
+	Exclude []string `json:"exclude" yaml:"exclude"`
+}
+
+// patterns returns all include and exclude patterns of the filter.
+func (f PatternFilter) patterns() []string {
+	return append(slices.Clone(f.Include), f.Exclude...)
+}
+
+// IsEnabled reports whether the collector is enabled.
+func (c CollectorConfig) IsEnabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// fileSettings describes the config file. Scalar fields missing from the file
+// are nil and keep the values from the command line flags.
+//
+// YAML example:
+//
+//	address: localhost:8080
+//	addresses: [old.example.com:8080, new.example.com:8080]
+//	upstream_mode: fanout
+//	report_interval: 10
+//	poll_interval: 2
+//	crypto_key: /etc/agent/server.pub
+//	collectors:
+//	  runtime:
+//	    include: ["Heap*", "NumGC"]
+//	  system:
+//	    poll_interval: 10
+//	    timeout: 5
+//	  disk:
+//	    mountpoints:
+//	      exclude: ["/boot*"]
+//	    fstypes:
+//	      include: ["ext4", "xfs"]
+//	  network:
+//	    interfaces:
+//	      exclude: ["lo", "veth*"]
+//	  process:
+//	    processes:
+//	      - group: postgres
+//	        name: "^postgres$"
+//	      - group: server
+//	        pidfile: /run/server.pid
+//	  cgroup:
+//	    cgroups: ["/system.slice/nginx.service"]
+//	  exec:
+//	    scripts:
+//	      - name: backup
+//	        command: ["/usr/local/bin/check_backup.sh", "--quiet"]
+//	        interval: 60
+//	        timeout: 10
+//	  textfile:
+//	    directory: /var/lib/agent/textfile
+//	  scrape:
+//	    poll_interval: 15
+//	    targets:
+//	      - name: node
+//	        url: http://localhost:9100/metrics
+//	  probe:
+//	    poll_interval: 30
+//	    probes:
+//	      - name: site
+//	        url: https://example.com/
+//	        timeout: 3
+//	      - name: postgres
+//	        address: localhost:5432
+//	  logtail:
+//	    state_file: /var/lib/agent/log_offsets.json
+//	    logs:
+//	      - path: /var/log/app.log
+//	        patterns:
+//	          - name: errors
+//	            regexp: "ERROR"
+//	          - name: latency
+//	            regexp: "latency=(?P<ms>[0-9.]+)"
+//	            value: ms
+//	  pollcount:
+//	    enabled: false
+//	rename:
+//	  HeapAlloc: GoHeapAlloc
+//	labels:
+//	  host: web1
+//	aggregate: [last, max, p95]
+//
+// JSON files use the same keys.
+type fileSettings struct {
+	RunAddr        *string                    `json:"address" yaml:"address"`
+	Addresses      []string                   `json:"addresses" yaml:"addresses"`
+	UpstreamMode   *string                    `json:"upstream_mode" yaml:"upstream_mode"`
+	ReportInterval *int                       `json:"report_interval" yaml:"report_interval"`
+	PollInterval   *int                       `json:"poll_interval" yaml:"poll_interval"`
+	Key            *string                    `json:"key" yaml:"key"`
+	RateLimit      *int                       `json:"rate_limit" yaml:"rate_limit"`
+	CryptoKey      *string                    `json:"crypto_key" yaml:"crypto_key"`
+	Collectors     map[string]CollectorConfig `json:"collectors" yaml:"collectors"`
+	Rename         map[string]string          `json:"rename" yaml:"rename"`
+	Labels         map[string]string          `json:"labels" yaml:"labels"`
+	Aggregate      []string                   `json:"aggregate" yaml:"aggregate"`
+}
+
+// applyFile overrides the configuration with the values present in the config file.
+func applyFile(path string) error {
+	var f fileSettings
+	if err := util.DecodeConfigFile(path, &f); err != nil {
+		return err
+	}
+
+	if f.RunAddr != nil {
+		FlagRunAddr = *f.RunAddr
+	}
+	if f.Addresses != nil {
+		FlagRunAddr = strings.Join(f.Addresses, ",")
+	}
+	if f.UpstreamMode != nil {
+		FlagUpstreamMode = *f.UpstreamMode
+	}
+	if f.ReportInterval != nil {
+		FlagReportInterval = *f.ReportInterval
+	}
+	if f.PollInterval != nil {
+		FlagPollInterval = *f.PollInterval
+	}
+	if f.Key != nil {
+		FlagKey = *f.Key
+	}
+	if f.RateLimit != nil {
+		FlagRateLimit = *f.RateLimit
+	}
+	if f.CryptoKey != nil {
+		FlagCryptoKey = *f.CryptoKey
+	}
+	Collectors = f.Collectors
+	Rename = f.Rename
+	Labels = f.Labels
+	if f.Aggregate != nil {
+		Aggregate = f.Aggregate
+	}
+	return nil
+}
+
+// Validate checks the configuration and returns all found problems joined into one error.
+//
+// Checked rules:
+//   - at least one address is required; every address must be in "host:port" format
+//     with a port between 1 and 65535
+//   - upstream mode must be "failover" or "fanout"
+//   - report interval, poll interval and rate limit must be positive
+//   - collector poll intervals and timeouts must not be negative
+//   - include/exclude, mountpoints, fstypes and interfaces patterns must be valid globs
+//   - process groups must have a unique name, a pidfile or a valid name/cmdline regexp
+//   - scripts must have a unique name, a command, a known format and non-negative interval and timeout
+//   - scrape targets must have a unique name and an http(s) URL
+//   - probes must have a unique name, either an http(s) URL or a host:port address and a non-negative timeout
+//   - logs must have a unique path and uniquely named patterns with valid regexps;
+//     a pattern value must name a capture group of its regexp
+//   - rename targets must not be empty
+//   - label names must match [a-zA-Z_][a-zA-Z0-9_]*
+//   - aggregate must list at least one known statistic
+func Validate() error {
+	var errs []error
+
+	addrs := ServerAddresses()
+	if len(addrs) == 0 {
+		errs = append(errs, fmt.Errorf("no server address"))
+	}
+	for _, addr := range addrs {
+		if err := util.ValidateAddress(addr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if !slices.Contains(client.UpstreamModes, FlagUpstreamMode) {
+		errs = append(errs, fmt.Errorf("unknown upstream mode %q, known modes: %v", FlagUpstreamMode, client.UpstreamModes))
+	}
+	if FlagReportInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid report interval %d: must be positive", FlagReportInterval))
+	}
+	if FlagPollInterval <= 0 {
+		errs = append(errs, fmt.Errorf("invalid poll interval %d: must be positive", FlagPollInterval))
+	}
+	if FlagRateLimit <= 0 {
+		errs = append(errs, fmt.Errorf("invalid rate limit %d: must be positive", FlagRateLimit))
+	}
+
+	for _, name := range sortedKeys(Collectors) {
+		c := Collectors[name]
+		if c.PollInterval < 0 {
+			errs = append(errs, fmt.Errorf("collector %q: invalid poll interval %d: must not be negative", name, c.PollInterval))
+		}
+		if c.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("collector %q: invalid timeout %d: must not be negative", name, c.Timeout))
+		}
+		patterns := append(slices.Clone(c.Include), c.Exclude...)
+		patterns = append(patterns, c.Mountpoints.patterns()...)
+		patterns = append(patterns, c.FSTypes.patterns()...)
+		patterns = append(patterns, c.Interfaces.patterns()...)
+		for _, p := range patterns {
+			if _, err := path.Match(p, ""); err != nil {
+				errs = append(errs, fmt.Errorf("collector %q: invalid pattern %q: %w", name, p, err))
+			}
+		}
+		errs = append(errs, validateProcesses(name, c.Processes)...)
+		errs = append(errs, validateScripts(name, c.Scripts)...)
+		errs = append(errs, validateTargets(name, c.Targets)...)
+		errs = append(errs, validateProbes(name, c.Probes)...)
+		errs = append(errs, validateLogs(name, c.Logs)...)
+	}
+	for _, from := range sortedKeys(Rename) {
+		if Rename[from] == "" {
+			errs = append(errs, fmt.Errorf("rename %q: new name must not be empty", from))
+		}
+	}
+	for _, name := range sortedKeys(Labels) {
+		if !labelNameRe.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid label name %q", name))
+		}
+	}
+	if len(Aggregate) == 0 {
+		errs = append(errs, fmt.Errorf("aggregate must list at least one statistic"))
+	}
+	for _, stat := range Aggregate {
+		if !slices.Contains(metrics.AggregationStats, stat) {
+			errs = append(errs, fmt.Errorf("unknown aggregation statistic %q, known statistics: %v", stat, metrics.AggregationStats))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateProcesses checks the process groups of a collector.
+func validateProcesses(collector string, processes []ProcessMatch) []error {
+	var errs []error
+	groups := make(map[string]struct{}, len(processes))
+	for i, p := range processes {
+		if p.Group == "" {
+			errs = append(errs, fmt.Errorf("collector %q: process %d: group must not be empty", collector, i))
+		} else if _, ok := groups[p.Group]; ok {
+			errs = append(errs, fmt.Errorf("collector %q: duplicate process group %q", collector, p.Group))
+		}
+		groups[p.Group] = struct{}{}
+
+		if p.Name == "" && p.Cmdline == "" && p.Pidfile == "" {
+			errs = append(errs, fmt.Errorf("collector %q: process group %q: name, cmdline or pidfile is required", collector, p.Group))
+		}
+		for _, expr := range []string{p.Name, p.Cmdline} {
+			if _, err := regexp.Compile(expr); err != nil {
+				errs = append(errs, fmt.Errorf("collector %q: process group %q: invalid regexp %q: %w", collector, p.Group, expr, err))
+			}
+		}
+	}
+	return errs
+}
+
+// validateScripts checks the scripts of a collector.
+func validateScripts(collector string, scripts []ScriptConfig) []error {
+	var errs []error
+	names := make(map[string]struct{}, len(scripts))
+	for i, sc := range scripts {
+		if sc.Name == "" {
+			errs = append(errs, fmt.Errorf("collector %q: script %d: name must not be empty", collector, i))
+		} else if _, ok := names[sc.Name]; ok {
+			errs = append(errs, fmt.Errorf("collector %q: duplicate script %q", collector, sc.Name))
+		}
+		names[sc.Name] = struct{}{}
+
+		if len(sc.Command) == 0 || sc.Command[0] == "" {
+			errs = append(errs, fmt.Errorf("collector %q: script %q: command must not be empty", collector, sc.Name))
+		}
+		if sc.Format != "" && sc.Format != "text" && sc.Format != "json" {
+			errs = append(errs, fmt.Errorf("collector %q: script %q: unknown format %q", collector, sc.Name, sc.Format))
+		}
+		if sc.Interval < 0 || sc.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("collector %q: script %q: interval and timeout must not be negative", collector, sc.Name))
+		}
+	}
+	return errs
+}
+
+// validateTargets checks the scrape targets of a collector.
+func validateTargets(collector string, targets []ScrapeTarget) []error {
+	var errs []error
+	names := make(map[string]struct{}, len(targets))
+	for i, t := range targets {
+		if t.Name == "" {
+			errs = append(errs, fmt.Errorf("collector %q: target %d: name must not be empty", collector, i))
+		} else if _, ok := names[t.Name]; ok {
+			errs = append(errs, fmt.Errorf("collector %q: duplicate target %q", collector, t.Name))
+		}
+		names[t.Name] = struct{}{}
+
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("collector %q: target %q: invalid url %q", collector, t.Name, t.URL))
+		}
+	}
+	return errs
+}
+
+// validateProbes checks the probes of a collector.
+func validateProbes(collector string, probes []ProbeTarget) []error {
+	var errs []error
+	names := make(map[string]struct{}, len(probes))
+	for i, p := range probes {
+		if p.Name == "" {
+			errs = append(errs, fmt.Errorf("collector %q: probe %d: name must not be empty", collector, i))
+		} else if _, ok := names[p.Name]; ok {
+			errs = append(errs, fmt.Errorf("collector %q: duplicate probe %q", collector, p.Name))
+		}
+		names[p.Name] = struct{}{}
+
+		switch {
+		case (p.URL == "") == (p.Address == ""):
+			errs = append(errs, fmt.Errorf("collector %q: probe %q: exactly one of url and address is required", collector, p.Name))
+		case p.URL != "":
+			u, err := url.Parse(p.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				errs = append(errs, fmt.Errorf("collector %q: probe %q: invalid url %q", collector, p.Name, p.URL))
+			}
+		default:
+			if _, _, err := net.SplitHostPort(p.Address); err != nil {
+				errs = append(errs, fmt.Errorf("collector %q: probe %q: invalid address %q", collector, p.Name, p.Address))
+			}
+		}
+		if p.Timeout < 0 {
+			errs = append(errs, fmt.Errorf("collector %q: probe %q: invalid timeout %d: must not be negative", collector, p.Name, p.Timeout))
+		}
+	}
+	return errs
+}
+
+// validateLogs checks the log files of a collector.
+func validateLogs(collector string, logs []LogConfig) []error {
+	var errs []error
+	paths := make(map[string]struct{}, len(logs))
+	for i, l := range logs {
+		if l.Path == "" {
+			errs = append(errs, fmt.Errorf("collector %q: log %d: path must not be empty", collector, i))
+		} else if _, ok := paths[l.Path]; ok {
+			errs = append(errs, fmt.Errorf("collector %q: duplicate log %q", collector, l.Path))
+		}
+		paths[l.Path] = struct{}{}
+
+		names := make(map[string]struct{}, len(l.Patterns))
+		for j, p := range l.Patterns {
+			if p.Name == "" {
+				errs = append(errs, fmt.Errorf("collector %q: log %q: pattern %d: name must not be empty", collector, l.Path, j))
+			} else if _, ok := names[p.Name]; ok {
+				errs = append(errs, fmt.Errorf("collector %q: log %q: duplicate pattern %q", collector, l.Path, p.Name))
+			}
+			names[p.Name] = struct{}{}
+
+			re, err := regexp.Compile(p.Regexp)
+			if err != nil || p.Regexp == "" {
+				errs = append(errs, fmt.Errorf("collector %q: log %q: pattern %q: invalid regexp %q", collector, l.Path, p.Name, p.Regexp))
+				continue
+			}
+			if p.Value != "" && re.SubexpIndex(p.Value) < 0 {
+				errs = append(errs, fmt.Errorf("collector %q: log %q: pattern %q: no capture group %q", collector, l.Path, p.Name, p.Value))
+			}
+		}
+	}
+	return errs
+}
+
+// ValidateCollectors checks that the config file only configures known collectors.
+//
+// Parameters:
+//   - known: names of the collectors available in the agent
+//
+// Returns an error listing all unknown collector names.
+func ValidateCollectors(known []string) error {
+	var errs []error
+	for _, name := range sortedKeys(Collectors) {
+		if !slices.Contains(known, name) {
+			errs = append(errs, fmt.Errorf("unknown collector %q, known collectors: %v", name, known))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CollectorPollInterval returns the poll interval of the named collector in seconds.
+func CollectorPollInterval(name string) int {
+	if c, ok := Collectors[name]; ok && c.PollInterval > 0 {
+		return c.PollInterval
+	}
+	return FlagPollInterval
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyFileAndValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`
+poll_interval: 5
+addresses: [old:8080, new:8080]
+upstream_mode: fanout
+crypto_key: server.pub
+collectors:
+  runtime:
+    include: ["Heap*"]
+  pollcount:
+    enabled: false
+  system:
+    poll_interval: 30
+  disk:
+    mountpoints:
+      exclude: ["/boot*"]
+    fstypes:
+      include: [ext4]
+  network:
+    interfaces:
+      exclude: [lo, "veth*"]
+  process:
+    processes:
+      - group: postgres
+        name: "^postgres$"
+      - group: server
+        pidfile: /run/server.pid
+  exec:
+    scripts:
+      - name: backup
+        command: [/usr/local/bin/check_backup.sh, --quiet]
+        format: json
+        interval: 60
+  scrape:
+    targets:
+      - name: node
+        url: http://localhost:9100/metrics
+  probe:
+    probes:
+      - name: db
+        address: localhost:5432
+        timeout: 2
+  logtail:
+    state_file: offsets.json
+    logs:
+      - path: /var/log/app.log
+        patterns:
+          - name: latency
+            regexp: "latency=(?P<ms>[0-9]+)"
+            value: ms
+rename:
+  HeapAlloc: GoHeapAlloc
+labels:
+  host: web1
+aggregate: [last, max]
+`), 0600))
+
+	FlagRunAddr, FlagReportInterval, FlagPollInterval, FlagRateLimit = "localhost:8080", 10, 2, 5
+	assert.NoError(t, applyFile(path))
+	assert.NoError(t, Validate())
+	assert.NoError(t, ValidateCollectors([]string{"runtime", "system", "disk", "network", "process", "exec", "scrape", "probe", "logtail", "pollcount"}))
+
+	t.Cleanup(func() { FlagUpstreamMode, FlagCryptoKey = "failover", "" })
+
+	assert.Equal(t, 5, FlagPollInterval)
+	assert.Equal(t, []string{"old:8080", "new:8080"}, ServerAddresses())
+	assert.Equal(t, "fanout", FlagUpstreamMode)
+	assert.Equal(t, "server.pub", FlagCryptoKey)
+	assert.Equal(t, 5, CollectorPollInterval("runtime"))
+	assert.Equal(t, 30, CollectorPollInterval("system"))
+	assert.False(t, Collectors["pollcount"].IsEnabled())
+	assert.True(t, Collectors["runtime"].IsEnabled())
+	assert.Equal(t, "GoHeapAlloc", Rename["HeapAlloc"])
+	assert.Equal(t, []string{"last", "max"}, Aggregate)
+	assert.Equal(t, []string{"/boot*"}, Collectors["disk"].Mountpoints.Exclude)
+	assert.Equal(t, []string{"ext4"}, Collectors["disk"].FSTypes.Include)
+	assert.Equal(t, []string{"lo", "veth*"}, Collectors["network"].Interfaces.Exclude)
+	assert.Equal(t, []ProcessMatch{
+		{Group: "postgres", Name: "^postgres$"},
+		{Group: "server", Pidfile: "/run/server.pid"},
+	}, Collectors["process"].Processes)
+	assert.Equal(t, []ScriptConfig{
+		{Name: "backup", Command: []string{"/usr/local/bin/check_backup.sh", "--quiet"}, Format: "json", Interval: 60},
+	}, Collectors["exec"].Scripts)
+	assert.Equal(t, []ScrapeTarget{{Name: "node", URL: "http://localhost:9100/metrics"}}, Collectors["scrape"].Targets)
+	assert.Equal(t, []ProbeTarget{{Name: "db", Address: "localhost:5432", Timeout: 2}}, Collectors["probe"].Probes)
+	assert.Equal(t, "offsets.json", Collectors["logtail"].StateFile)
+	assert.Equal(t, []LogConfig{{Path: "/var/log/app.log", Patterns: []LogPatternConfig{
+		{Name: "latency", Regexp: "latency=(?P<ms>[0-9]+)", Value: "ms"},
+	}}}, Collectors["logtail"].Logs)
+
+	assert.Error(t, ValidateCollectors([]string{"runtime"}))
+}
+
+func TestValidate_Errors(t *testing.T) {
+	FlagRunAddr, FlagReportInterval, FlagPollInterval, FlagRateLimit = "localhost:8080,localhost", 0, 2, 5
+	FlagUpstreamMode = "broadcast"
+	Collectors = map[string]CollectorConfig{
+		"runtime": {PollInterval: -1, Include: []string{"[a-"}},
+		"disk":    {FSTypes: PatternFilter{Exclude: []string{"[x"}}},
+		"process": {Processes: []ProcessMatch{{Group: "a", Name: "("}, {Group: "a"}, {}}},
+		"logtail": {Logs: []LogConfig{{Path: "app.log", Patterns: []LogPatternConfig{{Name: "x", Regexp: "a", Value: "ms"}}}}},
+		"probe":   {Probes: []ProbeTarget{{Name: "both", URL: "http://a", Address: "a:1"}, {Name: "db", Address: "db"}}},
+		"scrape":  {Targets: []ScrapeTarget{{Name: "node", URL: "localhost:9100"}}},
+		"exec":    {Scripts: []ScriptConfig{{Name: "a", Command: []string{"true"}, Format: "xml"}, {Name: "a", Timeout: -1}}},
+	}
+	Rename = map[string]string{"Alloc": ""}
+	Labels = map[string]string{"bad-label": "x"}
+	Aggregate = []string{"median"}
+	t.Cleanup(func() {
+		Collectors, Rename, Labels, Aggregate = nil, nil, nil, []string{"last"}
+		FlagUpstreamMode = "failover"
+	})
+
+	err := Validate()
+	assert.ErrorContains(t, err, `invalid address "localhost"`)
+	assert.ErrorContains(t, err, `unknown upstream mode "broadcast"`)
+	assert.ErrorContains(t, err, "invalid report interval 0")
+	assert.ErrorContains(t, err, `collector "runtime": invalid poll interval -1`)
+	assert.ErrorContains(t, err, `collector "runtime": invalid pattern "[a-"`)
+	assert.ErrorContains(t, err, `collector "disk": invalid pattern "[x"`)
+	assert.ErrorContains(t, err, `collector "process": process group "a": invalid regexp "("`)
+	assert.ErrorContains(t, err, `collector "process": duplicate process group "a"`)
+	assert.ErrorContains(t, err, `collector "process": process 2: group must not be empty`)
+	assert.ErrorContains(t, err, `process group "": name, cmdline or pidfile is required`)
+	assert.ErrorContains(t, err, `collector "exec": script "a": unknown format "xml"`)
+	assert.ErrorContains(t, err, `collector "exec": duplicate script "a"`)
+	assert.ErrorContains(t, err, `collector "exec": script "a": command must not be empty`)
+	assert.ErrorContains(t, err, `collector "exec": script "a": interval and timeout must not be negative`)
+	assert.ErrorContains(t, err, `collector "scrape": target "node": invalid url "localhost:9100"`)
+	assert.ErrorContains(t, err, `collector "probe": probe "both": exactly one of url and address is required`)
+	assert.ErrorContains(t, err, `collector "probe": probe "db": invalid address "db"`)
+	assert.ErrorContains(t, err, `collector "logtail": log "app.log": pattern "x": no capture group "ms"`)
+	assert.ErrorContains(t, err, `rename "Alloc"`)
+	assert.ErrorContains(t, err, `invalid label name "bad-label"`)
+	assert.ErrorContains(t, err, `unknown aggregation statistic "median"`)
+}
@@ -1,23 +1,30 @@
 // Package config provides agent configuration functionality.
-// It handles parsing of command line flags and environment variables
-// for a metrics collection and reporting agent.
+// It handles parsing of command line flags, an optional JSON/YAML config file
+// and environment variables for a metrics collection and reporting agent.
 package config
 
 import (
 	"flag"
 	"os"
 	"strconv"
+	"strings"
+
+	"github.com/DenisPavlov/monitoring/internal/client"
 )
 
 // Global configuration variables for the agent application.
 //
-// These variables store values obtained from command line flags
-// and environment variables. Environment variables take precedence.
+// These variables store values obtained from command line flags, the config file
+// and environment variables, in order of increasing precedence.
 var (
-	// FlagRunAddr is the server address and port to send metrics to.
-	// Format: "host:port". Default: "localhost:8080".
+	// FlagRunAddr is the comma-separated list of server addresses to send metrics to.
+	// Format: "host:port[,host:port...]". Default: "localhost:8080".
 	FlagRunAddr string
 
+	// FlagUpstreamMode is the way batches are distributed among several servers:
+	// "failover" (default) or "fanout" (see client.UpstreamModes).
+	FlagUpstreamMode = client.ModeFailover
+
 	// FlagReportInterval is the frequency of sending metrics to the server in seconds.
 	// Default: 10 seconds.
 	FlagReportInterval int
@@ -30,36 +37,71 @@ var (
 	// If empty, requests are sent without signing.
 	FlagKey string
 
-	// FlagRateLimit is the maximum number of concurrent requests allowed.
-	// Used to limit the load on both client and server.
-	// Default: 5 concurrent requests.
+	// FlagRateLimit is the maximum number of concurrent requests to the servers.
+	// Batches are taken one at a time in order; in the fan-out mode the limit applies
+	// to the sends to different servers.
+	// Default: 5.
 	FlagRateLimit int
+
+	// FlagCryptoKey is the path to the PEM file with the RSA public key of the server.
+	// If set, batches are encrypted with it; if empty, they are sent in plain text.
+	FlagCryptoKey string
+
+	// FlagConfigFile is the path to the JSON or YAML config file.
+	// If empty, no config file is read.
+	FlagConfigFile string
+
+	// Collectors holds per-collector settings from the config file indexed by collector name.
+	// Collectors missing from the map are enabled with default settings.
+	Collectors map[string]CollectorConfig
+
+	// Rename maps original metric names to the names they are reported with.
+	Rename map[string]string
+
+	// Labels are static labels added to every reported metric.
+	Labels map[string]string
+
+	// Aggregate lists the statistics of gauge samples sent on every report interval
+	// (see metrics.AggregationStats). Default: only the last sample.
+	Aggregate = []string{"last"}
 )
 
 // ParseFlags parses command line flags and environment variables for agent configuration.
 //
 // The function performs:
 //  1. Parsing of command line flags with default values
-//  2. Reading and applying environment variables (if set)
-//  3. Environment variables take precedence over command line flags
+//  2. Reading the config file (if set with -c or CONFIG) on top of the flags
+//  3. Reading and applying environment variables (if set)
+//  4. Validating the resulting configuration
+//
+// Precedence is flag < config file < environment variable.
 //
 // Supported command line flags:
 //
-//	-a: server address and port (default: "localhost:8080")
+//	-a: comma-separated server addresses (default: "localhost:8080")
+//	-m: upstream mode, "failover" or "fanout" (default: "failover")
 //	-r: report interval in seconds (default: 10)
 //	-p: poll interval in seconds (default: 2)
 //	-k: signing key (default: "")
 //	-l: rate limit (default: 5)
+//	-crypto-key: server public key file path (default: "")
+//	-c: config file path (default: "")
 //
 // Supported environment variables:
-//   - ADDRESS: server address and port (equivalent to flag -a)
+//   - ADDRESS: comma-separated server addresses (equivalent to flag -a)
+//   - UPSTREAM_MODE: upstream mode (equivalent to flag -m)
 //   - REPORT_INTERVAL: report interval in seconds (equivalent to flag -r)
 //   - POLL_INTERVAL: poll interval in seconds (equivalent to flag -p)
 //   - KEY: signing key (equivalent to flag -k)
 //   - RATE_LIMIT: rate limit (equivalent to flag -l)
+//   - CRYPTO_KEY: server public key file path (equivalent to flag -crypto-key)
+//   - CONFIG: config file path (equivalent to flag -c)
+//   - AGGREGATE: comma-separated gauge statistics, e.g. "last,max,p95"
 //
 // Returns an error if:
 //   - numeric values (REPORT_INTERVAL, POLL_INTERVAL, RATE_LIMIT) cannot be converted from strings
+//   - the config file cannot be read or contains unknown fields
+//   - the resulting configuration is invalid (see Validate)
 //
 // Usage example:
 //
@@ -79,16 +121,31 @@ var (
 //	export POLL_INTERVAL=2
 //	export RATE_LIMIT=5
 func ParseFlags() error {
-	flag.StringVar(&FlagRunAddr, "a", "localhost:8080", "server address and port")
+	flag.StringVar(&FlagRunAddr, "a", "localhost:8080", "comma-separated server addresses")
+	flag.StringVar(&FlagUpstreamMode, "m", client.ModeFailover, "upstream mode: failover or fanout")
 	flag.IntVar(&FlagReportInterval, "r", 10, "frequency of sending metrics to the server in seconds")
 	flag.IntVar(&FlagPollInterval, "p", 2, "frequency of getting runtime metrics in seconds")
 	flag.StringVar(&FlagKey, "k", "", "key used to sign the request")
 	flag.IntVar(&FlagRateLimit, "l", 5, "rate limit")
+	flag.StringVar(&FlagCryptoKey, "crypto-key", "", "path to the server public key file used to encrypt batches")
+	flag.StringVar(&FlagConfigFile, "c", "", "config file path (JSON or YAML)")
 	flag.Parse()
 
+	if envConfig := os.Getenv("CONFIG"); envConfig != "" {
+		FlagConfigFile = envConfig
+	}
+	if FlagConfigFile != "" {
+		if err := applyFile(FlagConfigFile); err != nil {
+			return err
+		}
+	}
+
 	if envRunAddr := os.Getenv("ADDRESS"); envRunAddr != "" {
 		FlagRunAddr = envRunAddr
 	}
+	if envUpstreamMode := os.Getenv("UPSTREAM_MODE"); envUpstreamMode != "" {
+		FlagUpstreamMode = envUpstreamMode
+	}
 	if envReportInterval := os.Getenv("REPORT_INTERVAL"); envReportInterval != "" {
 		val, err := strconv.Atoi(envReportInterval)
 		if err != nil {
@@ -113,6 +170,23 @@ func ParseFlags() error {
 		}
 		FlagRateLimit = val
 	}
+	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
+		FlagCryptoKey = envCryptoKey
+	}
+	if envAggregate := os.Getenv("AGGREGATE"); envAggregate != "" {
+		Aggregate = strings.Split(envAggregate, ",")
+	}
+
+	return Validate()
+}
 
-	return nil
+// ServerAddresses returns the server addresses listed in FlagRunAddr.
+func ServerAddresses() []string {
+	var addrs []string
+	for _, addr := range strings.Split(FlagRunAddr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"log"
 	"os/signal"
 	"sync"
@@ -11,6 +12,7 @@ import (
 	"github.com/DenisPavlov/monitoring/cmd/agent/config"
 	"github.com/DenisPavlov/monitoring/internal/build/info"
 	"github.com/DenisPavlov/monitoring/internal/client"
+	"github.com/DenisPavlov/monitoring/internal/encryption"
 	"github.com/DenisPavlov/monitoring/internal/models"
 	"github.com/DenisPavlov/monitoring/internal/service"
 )
@@ -33,117 +35,114 @@ func main() {
 }
 
 func run() error {
+	var publicKey *rsa.PublicKey
+	if config.FlagCryptoKey != "" {
+		var err error
+		if publicKey, err = encryption.LoadPublicKey(config.FlagCryptoKey); err != nil {
+			return err
+		}
+	}
+	upstream, err := client.NewUpstream(config.FlagUpstreamMode, config.ServerAddresses(), config.FlagKey, publicKey, config.FlagRateLimit)
+	if err != nil {
+		return err
+	}
+	registry, err := buildRegistry(upstream)
+	if err != nil {
+		return err
+	}
+	agg, err := metrics.NewAggregator(config.Aggregate)
+	if err != nil {
+		return err
+	}
+
+	outbox := client.NewOutbox(client.NewAgentID(), client.DefaultOutboxLimit)
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
 	var wg sync.WaitGroup
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		upstream.Run(ctx)
+	}()
+
 	metricsChan := make(chan []models.Metric)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		collectAndSend(ctx, time.Duration(config.FlagPollInterval)*time.Second, metricsChan)
+		registry.Run(ctx, metricsChan)
 	}()
 
-	reportChan := make(chan []models.Metric)
+	// Batches are sent one at a time in order, so a resent batch never races a newer one.
+	reportChan := make(chan client.Batch, client.DefaultOutboxLimit+1)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		collectReport(ctx, time.Duration(config.FlagReportInterval)*time.Second, metricsChan, reportChan)
+		collectReport(ctx, time.Duration(config.FlagReportInterval)*time.Second, agg, outbox, metricsChan, reportChan)
 	}()
 
-	wg.Add(config.FlagRateLimit)
-	for i := 0; i < config.FlagRateLimit; i++ {
-		go func(workerID int) {
-			defer wg.Done()
-			postMetricsWorker(ctx, workerID, reportChan)
-		}(i)
-	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		postMetricsWorker(ctx, upstream, outbox, reportChan)
+	}()
 
 	wg.Wait()
 
 	return nil
 }
 
-func collectAndSend(ctx context.Context, interval time.Duration, out chan<- []models.Metric) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	counters := make(map[string]int64)
-
-	for {
-		select {
-		case <-ctx.Done():
-			close(out)
-			return
-		case <-ticker.C:
-			log.Printf("Collecting metrics")
-			var metricsBatch []models.Metric
-
-			for name, value := range metrics.Gauge() {
-				metricsBatch = append(metricsBatch, models.Metric{
-					ID:    name,
-					MType: "gauge",
-					Value: &value,
-				})
-			}
-
-			for name, value := range metrics.AdditionalGauge() {
-				metricsBatch = append(metricsBatch, models.Metric{
-					ID:    name,
-					MType: "gauge",
-					Value: &value,
-				})
-			}
-
-			counters = metrics.Count(counters)
-			for name, value := range counters {
-				metricsBatch = append(metricsBatch, models.Metric{
-					ID:    name,
-					MType: "counter",
-					Delta: &value,
-				})
-			}
-
-			out <- metricsBatch
-		}
-	}
-}
-
-func postMetricsWorker(ctx context.Context, workerID int, in <-chan []models.Metric) {
+// postMetricsWorker sends the batches received from in one at a time. The counters of
+// batches that were not acknowledged are returned to the outbox and resent on the next
+// report interval.
+func postMetricsWorker(ctx context.Context, upstream client.Upstream, outbox *client.Outbox, in <-chan client.Batch) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case metric, ok := <-in:
+		case batch, ok := <-in:
 			if !ok {
 				return
 			}
-			log.Printf("[Worker %d] Sending %d metrics", workerID, len(metric))
-			if err := client.PostMetricsBatch(ctx, config.FlagRunAddr, config.FlagKey, metric); err != nil {
-				log.Printf("[Worker %d] Error sending metrics: %v", workerID, err)
+			log.Printf("Sending batch %d with %d metrics", batch.Seq, len(batch.Metrics))
+			if err := upstream.Send(ctx, batch); err != nil {
+				log.Printf("Error sending batch %d: %v", batch.Seq, err)
+				outbox.Requeue(batch)
 			}
 		}
 	}
 }
 
-func collectReport(ctx context.Context, interval time.Duration, in <-chan []models.Metric, out chan<- []models.Metric) {
+// collectReport aggregates the metrics received from the collectors. On every report
+// interval it resends the unacknowledged batches of the outbox and sends the
+// aggregated report as a new batch to out.
+func collectReport(ctx context.Context, interval time.Duration, agg *metrics.Aggregator, outbox *client.Outbox, in <-chan []models.Metric, out chan<- client.Batch) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	var currentMetrics []models.Metric
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			log.Printf("Sending metrics: %v", currentMetrics)
-			out <- currentMetrics
-		case metric, ok := <-in:
+			batches := outbox.Pending()
+			if agg.Len() > 0 {
+				batches = append(batches, outbox.Next(agg.Flush()))
+			}
+			for _, batch := range batches {
+				select {
+				case out <- batch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		case batch, ok := <-in:
 			if !ok {
 				return
 			}
-			currentMetrics = metric
+			agg.Add(batch)
 		}
 	}
 }
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DenisPavlov/monitoring/internal/util"
+	"github.com/sirupsen/logrus"
+)
+
+// settings is the complete server configuration assembled from all sources.
+type settings struct {
+	RunAddr         string
+	LogLevel        string
+	RunEnv          string
+	StoreInterval   int
+	FileStoragePath string
+	Restore         bool
+	DatabaseDSN     string
+	Key             string
+	LegacySign      bool
+	CryptoKey       string
+}
+
+// fileSettings describes the config file. Fields missing from the file are nil
+// and keep the values from the command line flags.
+//
+// JSON example:
+//
+//	{
+//	  "address": "localhost:8080",
+//	  "log_level": "Info",
+//	  "run_env": "production",
+//	  "store_interval": 300,
+//	  "store_file": "storage.json",
+//	  "restore": true,
+//	  "database_dsn": "",
+//	  "key": "secret",
+//	  "legacy_sign": false,
+//	  "crypto_key": "private.pem"
+//	}
+//
+// YAML files use the same keys.
+type fileSettings struct {
+	RunAddr         *string `json:"address" yaml:"address"`
+	LogLevel        *string `json:"log_level" yaml:"log_level"`
+	RunEnv          *string `json:"run_env" yaml:"run_env"`
+	StoreInterval   *int    `json:"store_interval" yaml:"store_interval"`
+	FileStoragePath *string `json:"store_file" yaml:"store_file"`
+	Restore         *bool   `json:"restore" yaml:"restore"`
+	DatabaseDSN     *string `json:"database_dsn" yaml:"database_dsn"`
+	Key             *string `json:"key" yaml:"key"`
+	LegacySign      *bool   `json:"legacy_sign" yaml:"legacy_sign"`
+	CryptoKey       *string `json:"crypto_key" yaml:"crypto_key"`
+}
+
+// applyFile overrides the settings with the values present in the config file.
+func (s *settings) applyFile(path string) error {
+	var f fileSettings
+	if err := util.DecodeConfigFile(path, &f); err != nil {
+		return err
+	}
+
+	if f.RunAddr != nil {
+		s.RunAddr = *f.RunAddr
+	}
+	if f.LogLevel != nil {
+		s.LogLevel = *f.LogLevel
+	}
+	if f.RunEnv != nil {
+		s.RunEnv = *f.RunEnv
+	}
+	if f.StoreInterval != nil {
+		s.StoreInterval = *f.StoreInterval
+	}
+	if f.FileStoragePath != nil {
+		s.FileStoragePath = *f.FileStoragePath
+	}
+	if f.Restore != nil {
+		s.Restore = *f.Restore
+	}
+	if f.DatabaseDSN != nil {
+		s.DatabaseDSN = *f.DatabaseDSN
+	}
+	if f.Key != nil {
+		s.Key = *f.Key
+	}
+	if f.LegacySign != nil {
+		s.LegacySign = *f.LegacySign
+	}
+	if f.CryptoKey != nil {
+		s.CryptoKey = *f.CryptoKey
+	}
+	return nil
+}
+
+// Validate checks the settings and returns all found problems joined into one error.
+//
+// Checked rules:
+//   - address must be in "host:port" format with a port between 1 and 65535
+//   - log level must be a known logrus level
+//   - store interval must not be negative
+func (s settings) Validate() error {
+	var errs []error
+
+	if err := util.ValidateAddress(s.RunAddr); err != nil {
+		errs = append(errs, err)
+	}
+	if _, err := logrus.ParseLevel(s.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log level %q", s.LogLevel))
+	}
+	if s.StoreInterval < 0 {
+		errs = append(errs, fmt.Errorf("invalid store interval %d: must not be negative", s.StoreInterval))
+	}
+
+	return errors.Join(errs...)
+}
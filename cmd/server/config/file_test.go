@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSettings_ApplyFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "server.yaml")
+	assert.NoError(t, os.WriteFile(yamlPath, []byte("address: localhost:9090\nstore_interval: 10\nlegacy_sign: true\n"), 0600))
+
+	s := settings{RunAddr: "localhost:8080", LogLevel: "Info", StoreInterval: 300, Key: "flag-key"}
+	assert.NoError(t, s.applyFile(yamlPath))
+	assert.Equal(t, "localhost:9090", s.RunAddr)
+	assert.Equal(t, 10, s.StoreInterval)
+	assert.Equal(t, "flag-key", s.Key)
+	assert.True(t, s.LegacySign)
+
+	jsonPath := filepath.Join(dir, "server.json")
+	assert.NoError(t, os.WriteFile(jsonPath, []byte(`{"key": "file-key", "unknown": 1}`), 0600))
+	assert.Error(t, s.applyFile(jsonPath))
+}
+
+func TestSettings_Validate(t *testing.T) {
+	valid := settings{RunAddr: "localhost:8080", LogLevel: "Info", StoreInterval: 300}
+	assert.NoError(t, valid.Validate())
+
+	invalid := settings{RunAddr: "localhost", LogLevel: "verbose", StoreInterval: -1}
+	err := invalid.Validate()
+	assert.ErrorContains(t, err, `invalid address "localhost"`)
+	assert.ErrorContains(t, err, `invalid log level "verbose"`)
+	assert.ErrorContains(t, err, "invalid store interval -1")
+
+	badPort := settings{RunAddr: ":http", LogLevel: "Info"}
+	assert.ErrorContains(t, badPort.Validate(), "port must be a number")
+}
+
+func TestLoad_EnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"log_level": "Debug", "key": "file-key"}`), 0600))
+	prev := FlagConfigFile
+	FlagConfigFile = path
+	t.Cleanup(func() { FlagConfigFile = prev })
+	t.Setenv("KEY", "env-key")
+
+	s, err := load(settings{RunAddr: "localhost:8080", LogLevel: "Info"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Debug", s.LogLevel)
+	assert.Equal(t, "env-key", s.Key)
+}
@@ -1,17 +1,22 @@
 // Package config provides application server configuration functionality.
-// It handles parsing of command line flags and environment variables.
+// It handles parsing of command line flags, an optional JSON/YAML config file
+// and environment variables, validation of the result and runtime reload of
+// reloadable settings.
 package config
 
 import (
 	"flag"
 	"os"
 	"strconv"
+	"sync/atomic"
 )
 
 // Global configuration variables for the server application.
 //
-// These variables store values obtained from command line flags
-// and environment variables. Environment variables take precedence.
+// These variables store values obtained from command line flags, the config file
+// and environment variables, in order of increasing precedence. They hold the
+// values the server was started with; settings changed by Reload are available
+// through Current.
 var (
 	// FlagRunAddr is the address and port to run the server.
 	// Format: "host:port". Default: "localhost:8080".
@@ -48,14 +53,58 @@ var (
 	// FlagKey is the key used to verify request signatures.
 	// Used for security and request authentication purposes.
 	FlagKey string
+
+	// FlagLegacySign enables requests signed with version 1 of the signing scheme,
+	// which covers the body only and can be replayed, and unsigned updates. Default: false.
+	FlagLegacySign bool
+
+	// FlagCryptoKey is the path to the PEM file with the RSA private key used to decrypt
+	// encrypted request bodies. If empty, encrypted requests are rejected.
+	FlagCryptoKey string
+
+	// FlagConfigFile is the path to the JSON or YAML config file.
+	// If empty, no config file is read.
+	FlagConfigFile string
 )
 
-// ParseFlags parses command line flags and environment variables.
+// flagSettings holds the values parsed from the command line. Reload applies the
+// config file and environment variables on top of them again.
+var flagSettings settings
+
+// current holds the reloadable settings currently in effect.
+var current atomic.Pointer[Reloadable]
+
+// Reloadable holds the settings that can be changed at runtime with Reload.
+type Reloadable struct {
+	// LogLevel is the logging level.
+	LogLevel string
+
+	// Key is the key used to verify request signatures and sign responses.
+	Key string
+
+	// StoreInterval is the file storage interval in seconds.
+	StoreInterval int
+}
+
+// Current returns the reloadable settings currently in effect.
+//
+// It is safe to call concurrently with Reload.
+func Current() Reloadable {
+	if r := current.Load(); r != nil {
+		return *r
+	}
+	return Reloadable{LogLevel: FlagLogLevel, Key: FlagKey, StoreInterval: FlagStoreInterval}
+}
+
+// ParseFlags parses command line flags, the config file and environment variables.
 //
 // The function performs:
 //  1. Parsing of command line flags with default values
-//  2. Reading and applying environment variables (if set)
-//  3. Environment variables take precedence over command line flags
+//  2. Reading the config file (if set with -c or CONFIG) on top of the flags
+//  3. Reading and applying environment variables (if set)
+//  4. Validating the resulting configuration
+//
+// Precedence is flag < config file < environment variable.
 //
 // Supported environment variables:
 //   - ADDRESS: server address and port (equivalent to flag -a)
@@ -66,10 +115,15 @@ var (
 //   - RESTORE: restore flag (equivalent to flag -r)
 //   - DATABASE_DSN: database DSN (equivalent to flag -d)
 //   - KEY: signature key (equivalent to flag -k)
+//   - LEGACY_SIGN: accept version 1 and unsigned requests (equivalent to flag -legacy-sign)
+//   - CRYPTO_KEY: private key file path (equivalent to flag -crypto-key)
+//   - CONFIG: config file path (equivalent to flag -c)
 //
 // Returns an error if:
 //   - numeric values (STORE_INTERVAL) cannot be converted
-//   - boolean values (RESTORE) cannot be converted
+//   - boolean values (RESTORE, LEGACY_SIGN) cannot be converted
+//   - the config file cannot be read or contains unknown fields
+//   - the resulting configuration is invalid (see Validate)
 //
 // Usage example:
 //
@@ -80,7 +134,7 @@ var (
 //
 // Command line flags example:
 //
-//	./app -a localhost:8080 -l Info -i 300 -r true
+//	./app -a localhost:8080 -l Info -i 300 -r true -c server.yaml
 //
 // Environment variables example:
 //
@@ -88,26 +142,97 @@ var (
 //	export LOG_LEVEL=Info
 //	export STORE_INTERVAL=300
 func ParseFlags() error {
-	flag.StringVar(&FlagRunAddr, "a", "localhost:8080", "address and port to run server")
-	flag.StringVar(&FlagLogLevel, "l", "Info", "log level")
-	flag.StringVar(&FlagRunEnv, "e", "production", "Run environment")
-	flag.IntVar(&FlagStoreInterval, "i", 300, "File store interval in seconds")
-	flag.StringVar(&FlagFileStoragePath, "f", "", "Storage file path")
-	flag.BoolVar(&FlagRestore, "r", false, "Load storage data from file")
-	flag.StringVar(&FlagDatabaseDSN, "d", "", "Database DSN")
-	flag.StringVar(&FlagKey, "k", "", "key used to check the request sign")
+	flag.StringVar(&flagSettings.RunAddr, "a", "localhost:8080", "address and port to run server")
+	flag.StringVar(&flagSettings.LogLevel, "l", "Info", "log level")
+	flag.StringVar(&flagSettings.RunEnv, "e", "production", "Run environment")
+	flag.IntVar(&flagSettings.StoreInterval, "i", 300, "File store interval in seconds")
+	flag.StringVar(&flagSettings.FileStoragePath, "f", "", "Storage file path")
+	flag.BoolVar(&flagSettings.Restore, "r", false, "Load storage data from file")
+	flag.StringVar(&flagSettings.DatabaseDSN, "d", "", "Database DSN")
+	flag.StringVar(&flagSettings.Key, "k", "", "key used to check the request sign")
+	flag.BoolVar(&flagSettings.LegacySign, "legacy-sign", false, "Accept unsigned requests and requests signed with the body-only scheme version 1")
+	flag.StringVar(&flagSettings.CryptoKey, "crypto-key", "", "Path to the private key file used to decrypt requests")
+	flag.StringVar(&FlagConfigFile, "c", "", "Config file path (JSON or YAML)")
 	flag.Parse()
 
+	if envConfig := os.Getenv("CONFIG"); envConfig != "" {
+		FlagConfigFile = envConfig
+	}
+
+	s, err := load(flagSettings)
+	if err != nil {
+		return err
+	}
+
+	FlagRunAddr = s.RunAddr
+	FlagLogLevel = s.LogLevel
+	FlagRunEnv = s.RunEnv
+	FlagStoreInterval = s.StoreInterval
+	FlagFileStoragePath = s.FileStoragePath
+	FlagRestore = s.Restore
+	FlagDatabaseDSN = s.DatabaseDSN
+	FlagKey = s.Key
+	FlagLegacySign = s.LegacySign
+	FlagCryptoKey = s.CryptoKey
+	current.Store(&Reloadable{LogLevel: s.LogLevel, Key: s.Key, StoreInterval: s.StoreInterval})
+
+	return nil
+}
+
+// Reload re-reads the config file and environment variables on top of the
+// command line flags, validates the result and applies the reloadable settings.
+//
+// Only LogLevel, Key and StoreInterval are applied. Changes of other settings
+// require a restart and are ignored. If the new configuration is invalid,
+// the settings in effect are kept and the error is returned.
+//
+// Returns:
+//   - Reloadable: the reloadable settings in effect after the reload
+//   - error: if the configuration cannot be loaded or is invalid
+//
+// Usage example:
+//
+//	reloaded, err := config.Reload()
+//	if err != nil {
+//	    logger.Log.Error("Failed to reload config:", err)
+//	}
+func Reload() (Reloadable, error) {
+	s, err := load(flagSettings)
+	if err != nil {
+		return Current(), err
+	}
+	r := &Reloadable{LogLevel: s.LogLevel, Key: s.Key, StoreInterval: s.StoreInterval}
+	current.Store(r)
+	return *r, nil
+}
+
+// load applies the config file and environment variables on top of base
+// and validates the result.
+func load(base settings) (settings, error) {
+	s := base
+	if FlagConfigFile != "" {
+		if err := s.applyFile(FlagConfigFile); err != nil {
+			return s, err
+		}
+	}
+	if err := s.applyEnv(); err != nil {
+		return s, err
+	}
+	return s, s.Validate()
+}
+
+// applyEnv overrides the settings with values of the set environment variables.
+func (s *settings) applyEnv() error {
 	if envRunAddr := os.Getenv("ADDRESS"); envRunAddr != "" {
-		FlagRunAddr = envRunAddr
+		s.RunAddr = envRunAddr
 	}
 
 	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
-		FlagLogLevel = envLogLevel
+		s.LogLevel = envLogLevel
 	}
 
 	if envRunEnv := os.Getenv("RUN_ENV"); envRunEnv != "" {
-		FlagRunEnv = envRunEnv
+		s.RunEnv = envRunEnv
 	}
 
 	if envStoreInterval := os.Getenv("STORE_INTERVAL"); envStoreInterval != "" {
@@ -115,11 +240,11 @@ func ParseFlags() error {
 		if err != nil {
 			return err
 		}
-		FlagStoreInterval = val
+		s.StoreInterval = val
 	}
 
 	if envFileStoragePath := os.Getenv("FILE_STORAGE_PATH"); envFileStoragePath != "" {
-		FlagFileStoragePath = envFileStoragePath
+		s.FileStoragePath = envFileStoragePath
 	}
 
 	if envRestore := os.Getenv("RESTORE"); envRestore != "" {
@@ -127,15 +252,27 @@ func ParseFlags() error {
 		if err != nil {
 			return err
 		}
-		FlagRestore = val
+		s.Restore = val
 	}
 
 	if envDatabaseDSN := os.Getenv("DATABASE_DSN"); envDatabaseDSN != "" {
-		FlagDatabaseDSN = envDatabaseDSN
+		s.DatabaseDSN = envDatabaseDSN
 	}
 
 	if envKey := os.Getenv("KEY"); envKey != "" {
-		FlagKey = envKey
+		s.Key = envKey
+	}
+
+	if envCryptoKey := os.Getenv("CRYPTO_KEY"); envCryptoKey != "" {
+		s.CryptoKey = envCryptoKey
+	}
+
+	if envLegacySign := os.Getenv("LEGACY_SIGN"); envLegacySign != "" {
+		val, err := strconv.ParseBool(envLegacySign)
+		if err != nil {
+			return err
+		}
+		s.LegacySign = val
 	}
 
 	return nil
@@ -2,10 +2,13 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"database/sql"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	_ "net/http/pprof"
@@ -13,8 +16,12 @@ import (
 	"github.com/DenisPavlov/monitoring/cmd/server/config"
 	"github.com/DenisPavlov/monitoring/internal/build/info"
 	"github.com/DenisPavlov/monitoring/internal/database"
+	"github.com/DenisPavlov/monitoring/internal/encryption"
 	"github.com/DenisPavlov/monitoring/internal/handler"
+	"github.com/DenisPavlov/monitoring/internal/health"
+	"github.com/DenisPavlov/monitoring/internal/idempotency"
 	"github.com/DenisPavlov/monitoring/internal/logger"
+	"github.com/DenisPavlov/monitoring/internal/models"
 	"github.com/DenisPavlov/monitoring/internal/storage"
 	"golang.org/x/sync/errgroup"
 )
@@ -41,13 +48,27 @@ func run() error {
 		return err
 	}
 
-	db, err := database.InitDB(config.FlagDatabaseDSN)
-	if err != nil {
-		return err
+	var privateKey *rsa.PrivateKey
+	if config.FlagCryptoKey != "" {
+		if privateKey, err = encryption.LoadPrivateKey(config.FlagCryptoKey); err != nil {
+			return err
+		}
 	}
-	defer func() {
-		_ = db.Close()
-	}()
+
+	var db *sql.DB
+	if config.FlagDatabaseDSN != "" {
+		db, err = database.InitDB(config.FlagDatabaseDSN)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = db.Close()
+		}()
+	}
+
+	healthRegistry := health.NewRegistry()
+	var startup health.Startup
+	healthRegistry.Register("startup", health.Readiness, startup.Check)
 
 	var store storage.MetricsStorage
 	store, err = initStorage(db)
@@ -56,11 +77,31 @@ func run() error {
 		store = storage.NewMemStorage()
 	}
 
-	if fileStorage, ok := store.(*storage.FileMetricsStorage); ok {
-		go storeMetricsIfNeeded(config.FlagStoreInterval, config.FlagFileStoragePath, fileStorage)
+	fileStorage, isFileStorage := store.(*storage.FileMetricsStorage)
+	if isFileStorage {
+		go storeMetricsIfNeeded(func() int { return config.Current().StoreInterval }, config.FlagFileStoragePath, fileStorage)
 	}
 
-	router := handler.BuildRouter(store, db, config.FlagKey)
+	registerStorageChecks(healthRegistry, store)
+
+	selfMetrics := storage.NewMemStorage()
+	instrumented := storage.NewInstrumentedStorage(store, selfMetrics)
+	router := handler.BuildRouter(instrumented, db, config.FlagKey,
+		handler.WithSelfMetrics(selfMetrics),
+		handler.WithHealth(healthRegistry),
+		handler.WithKeyProvider(func() string { return config.Current().Key }),
+		handler.WithLegacySignatures(config.FlagLegacySign),
+		handler.WithPrivateKey(privateKey),
+		handler.WithIdempotencyStore(initIdempotencyStore(store, db)),
+	)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(fileStorage)
+		}
+	}()
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt)
@@ -78,14 +119,21 @@ func run() error {
 		}
 	}()
 
+	listener, err := net.Listen("tcp", config.FlagRunAddr)
+	if err != nil {
+		return err
+	}
+
 	g, _ := errgroup.WithContext(context.Background())
 	g.Go(func() error {
 		logger.Log.Infoln("Running server on", config.FlagRunAddr)
-		if err := http.ListenAndServe(config.FlagRunAddr, router); err != nil {
+		if err := http.Serve(listener, router); err != nil {
 			return err
 		}
 		return nil
 	})
+	// The listener is bound, so the server accepts requests from now on.
+	startup.MarkReady()
 
 	g.Go(func() error {
 		logger.Log.Infoln("Running debug server on", "localhost:8082")
@@ -135,6 +183,10 @@ func initFileStorage() (storage.MetricsStorage, error) {
 	return fileStorage, nil
 }
 
+// appliedBatchesTTL is how long the batches applied by the postgres storage are remembered.
+// An agent resends a batch within minutes, and a restarted agent uses a new ID.
+const appliedBatchesTTL = 24 * time.Hour
+
 func initDBStorage(db *sql.DB) (storage.MetricsStorage, error) {
 	logger.Log.Infoln("Initializing postgres database storage")
 	store, err := storage.NewPostgresStorage(db)
@@ -145,22 +197,114 @@ func initDBStorage(db *sql.DB) (storage.MetricsStorage, error) {
 	if err != nil {
 		return nil, err
 	}
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := store.DeleteAppliedBatches(context.Background(), appliedBatchesTTL); err != nil {
+				logger.Log.Error("Error deleting applied batches", err)
+			}
+		}
+	}()
 	return store, nil
 }
 
-func storeMetricsIfNeeded(flagStoreInterval int, filename string, store *storage.FileMetricsStorage) {
-	if flagStoreInterval != 0 {
-		count := 1
-		for {
-			if count%flagStoreInterval == 0 {
-				logger.Log.Infoln("Store metrics to file ", filename)
-				err := store.SaveToFile()
-				if err != nil {
-					logger.Log.Errorln(err)
-				}
+// initIdempotencyStore returns the store of idempotency keys: a table of the database
+// for the postgres storage, so keys survive restarts, and memory otherwise.
+func initIdempotencyStore(store storage.MetricsStorage, db *sql.DB) idempotency.Store {
+	if _, ok := store.(*storage.PostgresMetricsStorage); !ok {
+		return idempotency.NewMemoryStore(idempotency.DefaultTTL)
+	}
+	pgStore := idempotency.NewPostgresStore(db, idempotency.DefaultTTL)
+	if err := pgStore.InitSchema(context.Background()); err != nil {
+		logger.Log.Error("Error initializing idempotency keys table, keeping keys in memory", err)
+		return idempotency.NewMemoryStore(idempotency.DefaultTTL)
+	}
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := pgStore.DeleteExpired(context.Background()); err != nil {
+				logger.Log.Error("Error deleting expired idempotency keys", err)
+			}
+		}
+	}()
+	return pgStore
+}
+
+// registerStorageChecks registers health checks specific to the storage backend.
+//
+// Registered checks:
+//   - memory and file storage: "storage" liveness check reading from the storage
+//   - postgres storage: "postgres" readiness check pinging the database
+//   - file storage: "file_writable" readiness check and "file_snapshot_age" readiness
+//     check failing if the file was not saved for two store intervals (skipped when
+//     saving synchronously)
+func registerStorageChecks(registry *health.Registry, store storage.MetricsStorage) {
+	switch s := store.(type) {
+	case *storage.PostgresMetricsStorage:
+		registry.Register("postgres", health.Readiness, s.Ping)
+	case *storage.FileMetricsStorage:
+		registry.Register("storage", health.Liveness, memoryStorageCheck(s.MemoryMetricsStorage))
+		registry.Register("file_writable", health.Readiness, s.CheckWritable)
+		registry.Register("file_snapshot_age", health.Readiness, func(ctx context.Context) error {
+			interval := config.Current().StoreInterval
+			if interval == 0 {
+				return nil
+			}
+			maxAge := 2 * time.Duration(interval) * time.Second
+			return health.MaxAge(s.LastSavedAt, maxAge)(ctx)
+		})
+	case *storage.MemoryMetricsStorage:
+		registry.Register("storage", health.Liveness, memoryStorageCheck(s))
+	}
+}
+
+// memoryStorageCheck returns a check that fails if the in-memory storage cannot
+// be read within the check timeout, e.g. because of a stuck lock.
+func memoryStorageCheck(s *storage.MemoryMetricsStorage) health.Check {
+	return func(ctx context.Context) error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := s.GetAllByType(ctx, models.CounterMetricName)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reloadConfig reloads the configuration on SIGHUP and applies the reloadable
+// settings: the log level and the file storage sync mode. The signing key and
+// the store interval are read from config.Current where they are used.
+func reloadConfig(fileStorage *storage.FileMetricsStorage) {
+	logger.Log.Infoln("Reloading configuration")
+	reloaded, err := config.Reload()
+	if err != nil {
+		logger.Log.Errorf("Can not reload configuration, keeping current settings: %v", err)
+		return
+	}
+	if err := logger.SetLevel(reloaded.LogLevel); err != nil {
+		logger.Log.Errorln(err)
+	}
+	if fileStorage != nil {
+		fileStorage.SetSaveSync(reloaded.StoreInterval == 0)
+	}
+	logger.Log.Infof("Configuration reloaded: log level %s, store interval %ds, signing key set: %t",
+		reloaded.LogLevel, reloaded.StoreInterval, reloaded.Key != "")
+}
+
+func storeMetricsIfNeeded(storeInterval func() int, filename string, store *storage.FileMetricsStorage) {
+	count := 1
+	for {
+		if interval := storeInterval(); interval != 0 && count%interval == 0 {
+			logger.Log.Infoln("Store metrics to file ", filename)
+			err := store.SaveToFile()
+			if err != nil {
+				logger.Log.Errorln(err)
 			}
-			count++
-			time.Sleep(time.Second)
 		}
+		count++
+		time.Sleep(time.Second)
 	}
 }
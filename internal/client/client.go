@@ -1,75 +1,110 @@
-// Package client provides functionality for sending metrics to a monitoring server.
-// It includes features like request compression, signing, and retry mechanisms.
+// Package client provides functionality for sending metrics of the agent to monitoring
+// servers on top of the public API client: batch sequencing, resending and failover.
 package client
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/json"
-	"net/http"
+	"crypto/rsa"
+	"strconv"
 	"time"
 
-	"github.com/DenisPavlov/monitoring/internal/handler"
+	sdk "github.com/DenisPavlov/monitoring/client"
 	"github.com/DenisPavlov/monitoring/internal/logger"
 	"github.com/DenisPavlov/monitoring/internal/models"
-	"github.com/DenisPavlov/monitoring/internal/util"
 )
 
-func postMetric(ctx context.Context, host, signKey string, metrics []models.Metric) error {
-	strReqBody, err := json.Marshal(metrics)
-	if err != nil {
-		return err
-	}
+// Batch is a report sent to the /updates/ endpoint.
+//
+// A batch with an AgentID is identified by the agent and its sequence number:
+// the server applies it at most once, so an unacknowledged batch can be resent
+// safely as is.
+type Batch struct {
+	// AgentID is the unique ID of the sending agent; empty disables deduplication.
+	AgentID string
+	// Seq is the sequence number of the batch within the agent.
+	Seq uint64
+	// Metrics holds gauge values and counter deltas.
+	Metrics []models.Metric
 
-	var buffer bytes.Buffer
-	gzipWriter := gzip.NewWriter(&buffer)
-	if _, err = gzipWriter.Write(strReqBody); err != nil {
-		return err
-	}
+	// countersOnly is set by Outbox.Requeue, which drops the gauges of the batch.
+	countersOnly bool
+}
 
-	err = gzipWriter.Close()
-	if err != nil {
-		return err
+// idempotencyKey returns the key of a batch of an agent: "AgentID-Seq", with a
+// "-counters" suffix for a requeued batch, so the key always matches the same body.
+func (b Batch) idempotencyKey() string {
+	key := b.AgentID + "-" + strconv.FormatUint(b.Seq, 10)
+	if b.countersOnly {
+		key += "-counters"
 	}
+	return key
+}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+host+"/updates/", &buffer)
-	if err != nil {
-		return err
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Encoding", "gzip")
-	req.Header.Set("Accept-Encoding", "gzip")
+// retryPolicy is the retry policy of agent requests. The budget is shared by all
+// servers, so an outage does not multiply the number of requests.
+var retryPolicy = sdk.RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   time.Second,
+	MaxDelay:    10 * time.Second,
+	Budget:      sdk.NewRetryBudget(0.2, 10),
+}
+
+const (
+	// requestTimeout limits a single request attempt.
+	requestTimeout = 30 * time.Second
+	// failoverRequestTimeout limits a request in the failover mode, where a server
+	// that does not respond in time is replaced by the next one.
+	failoverRequestTimeout = 10 * time.Second
+)
 
-	if signKey != "" {
-		signRequest(req, strReqBody, signKey)
+// newServerClient creates the API client of a server. Batches are encrypted with
+// publicKey unless it is nil.
+//
+// The client of a failover server does not retry requests: a failed batch is sent to
+// the next server at once instead of waiting for the retries of an unavailable one.
+func newServerClient(host, signKey string, publicKey *rsa.PublicKey, failover bool) (*sdk.Client, error) {
+	policy, timeout := retryPolicy, requestTimeout
+	if failover {
+		policy, timeout = sdk.RetryPolicy{}, failoverRequestTimeout
 	}
+	return sdk.New(host,
+		sdk.WithSignKey(signKey),
+		sdk.WithEncryption(publicKey),
+		sdk.WithRetryPolicy(policy),
+		sdk.WithTimeout(timeout),
+	)
+}
 
-	retries := 4
-	var resp *http.Response
+// postBatch sends a batch with the headers identifying it.
+//
+// A batch of an agent is sent with its sequence number and a stable idempotency key
+// (see Batch.idempotencyKey), kept when the batch is retried or resent by the outbox.
+// Other batches get the random key of the API client when retries are enabled.
+func postBatch(ctx context.Context, c *sdk.Client, batch Batch) error {
+	var opts []sdk.RequestOption
+	if batch.AgentID != "" {
+		opts = append(opts,
+			sdk.WithBatchSequence(batch.AgentID, batch.Seq),
+			sdk.WithIdempotencyKey(batch.idempotencyKey()),
+		)
+	}
+	return c.UpdateBatch(ctx, toSDKMetrics(batch.Metrics), opts...)
+}
 
-	for i := 0; i < retries; i++ {
-		logger.Log.Infof("Posting metrics to %s with attention %d", host, i)
-		resp, err = http.DefaultClient.Do(req)
-		if err != nil {
-			return err
-		}
-		if shouldRetry(resp) {
-			time.Sleep(util.Backoff(i))
-		} else {
-			if err := resp.Body.Close(); err != nil {
-				return err
-			}
-			return nil
-		}
+// toSDKMetrics converts metrics to the type of the API client.
+func toSDKMetrics(metrics []models.Metric) []sdk.Metric {
+	converted := make([]sdk.Metric, len(metrics))
+	for i, m := range metrics {
+		converted[i] = sdk.Metric{ID: m.ID, MType: m.MType, Delta: m.Delta, Value: m.Value}
 	}
-	return nil
+	return converted
 }
 
 // PostMetricsBatch sends a batch of metrics to the monitoring server.
 //
-// This is the public interface for sending metrics. It wraps the internal
-// postMetric function with error logging.
+// The batch is gzip-compressed and signed with signKey unless it is empty.
+// Connection errors and 429 and 5xx responses are retried with jittered
+// exponential backoff under a retry budget shared by all agent requests.
 //
 // Parameters:
 //   - ctx: context for request cancellation and timeout
@@ -78,7 +113,7 @@ func postMetric(ctx context.Context, host, signKey string, metrics []models.Metr
 //   - metrics: slice of Metric objects to send
 //
 // Returns:
-//   - error: if the metrics posting operation fails
+//   - error: if the metrics posting operation fails or the server does not respond with 200 OK
 //
 // Example usage:
 //
@@ -88,23 +123,21 @@ func postMetric(ctx context.Context, host, signKey string, metrics []models.Metr
 //	    // handle error
 //	}
 func PostMetricsBatch(ctx context.Context, host, signKey string, metrics []models.Metric) error {
-	if err := postMetric(ctx, host, signKey, metrics); err != nil {
+	return PostBatch(ctx, host, signKey, Batch{Metrics: metrics})
+}
+
+// PostBatch sends a batch with its agent ID and sequence number to the monitoring server.
+//
+// The batch is acknowledged only if PostBatch returns nil; otherwise it may or may
+// not have been applied and should be resent unchanged (see Outbox).
+func PostBatch(ctx context.Context, host, signKey string, batch Batch) error {
+	c, err := newServerClient(host, signKey, nil, false)
+	if err != nil {
+		return err
+	}
+	if err := postBatch(ctx, c, batch); err != nil {
 		logger.Log.Errorf("Posting metrics failed: %s", err.Error())
 		return err
 	}
 	return nil
 }
-
-func shouldRetry(resp *http.Response) bool {
-	if resp.StatusCode == http.StatusBadGateway ||
-		resp.StatusCode == http.StatusServiceUnavailable ||
-		resp.StatusCode == http.StatusGatewayTimeout {
-		return true
-	}
-	return false
-}
-
-func signRequest(req *http.Request, body []byte, key string) {
-	sign := util.GetHexSHA256(key, body)
-	req.Header.Set(handler.SHA256HeaderName, sign)
-}
@@ -0,0 +1,24 @@
+package client
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToSDKMetrics(t *testing.T) {
+	delta, value := int64(3), 1.5
+	metrics := []models.Metric{
+		{ID: "PollCount", MType: models.CounterMetricName, Delta: &delta},
+		{ID: `DiskFree{mountpoint="/"}`, MType: models.GaugeMetricName, Value: &value},
+	}
+
+	want, err := json.Marshal(metrics)
+	require.NoError(t, err)
+	got, err := json.Marshal(toSDKMetrics(metrics))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(want), string(got), "the API client sends the same JSON")
+}
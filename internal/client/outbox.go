@@ -0,0 +1,94 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/DenisPavlov/monitoring/internal/logger"
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// DefaultOutboxLimit is the default number of unacknowledged batches kept by Outbox.
+const DefaultOutboxLimit = 100
+
+// NewAgentID returns a random agent ID. A new ID must be used on every start,
+// since sequence numbers start over.
+func NewAgentID() string {
+	return randomID()
+}
+
+// randomID returns 16 random bytes in hex.
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Outbox numbers the reports of an agent and keeps the batches that were not
+// acknowledged by the server for resending.
+//
+// Counter deltas of a failed batch are neither lost nor merged into a later batch:
+// they are resent with the sequence number of the batch, and the server drops them
+// if the first attempt was applied after all. Gauges are not resent, since a later
+// report carries newer values and an old value must not overwrite them.
+//
+// Outbox is safe for concurrent use.
+type Outbox struct {
+	agentID string
+	limit   int
+
+	mu      sync.Mutex
+	seq     uint64
+	pending []Batch
+}
+
+// NewOutbox creates an outbox for the agent.
+//
+// Parameters:
+//   - agentID: unique agent ID, see NewAgentID
+//   - limit: maximum number of unacknowledged batches; the oldest ones are dropped beyond it
+func NewOutbox(agentID string, limit int) *Outbox {
+	return &Outbox{agentID: agentID, limit: limit}
+}
+
+// Next returns a batch with the next sequence number.
+func (o *Outbox) Next(metrics []models.Metric) Batch {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.seq++
+	return Batch{AgentID: o.agentID, Seq: o.seq, Metrics: metrics}
+}
+
+// Requeue keeps the counter deltas of a batch that was not acknowledged for resending.
+// A batch without counters is dropped. The resent batch gets its own idempotency key, since
+// its body differs from the original one.
+func (o *Outbox) Requeue(batch Batch) {
+	var counters []models.Metric
+	for _, m := range batch.Metrics {
+		if m.MType == models.CounterMetricName {
+			counters = append(counters, m)
+		}
+	}
+	if len(counters) == 0 {
+		return
+	}
+	batch.Metrics, batch.countersOnly = counters, true
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.pending = append(o.pending, batch)
+	if drop := len(o.pending) - o.limit; drop > 0 {
+		logger.Log.Errorf("Dropping %d unacknowledged batches", drop)
+		o.pending = o.pending[drop:]
+	}
+}
+
+// Pending removes and returns the batches to resend, oldest first.
+func (o *Outbox) Pending() []Batch {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	pending := o.pending
+	o.pending = nil
+	return pending
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutbox(t *testing.T) {
+	o := NewOutbox("agent", 2)
+	b1 := o.Next([]models.Metric{{ID: "PollCount", MType: models.CounterMetricName}})
+	b2 := o.Next([]models.Metric{{ID: "CollectorErrors", MType: models.CounterMetricName}})
+	b3 := o.Next([]models.Metric{{ID: "PollCount", MType: models.CounterMetricName}})
+	assert.Equal(t, "agent", b1.AgentID)
+	assert.Equal(t, []uint64{1, 2, 3}, []uint64{b1.Seq, b2.Seq, b3.Seq})
+
+	assert.Empty(t, o.Pending())
+	o.Requeue(b1)
+	o.Requeue(b2)
+	o.Requeue(b3)
+	pending := o.Pending()
+	assert.Equal(t, []uint64{b2.Seq, b3.Seq}, []uint64{pending[0].Seq, pending[1].Seq}, "the oldest batches are dropped beyond the limit")
+	assert.Len(t, pending, 2)
+	assert.Empty(t, o.Pending())
+}
+
+func TestNewAgentID(t *testing.T) {
+	assert.Len(t, NewAgentID(), 32)
+	assert.NotEqual(t, NewAgentID(), NewAgentID())
+}
+
+func TestOutbox_RequeueCountersOnly(t *testing.T) {
+	o := NewOutbox("agent", DefaultOutboxLimit)
+	value := 1.5
+	counter := models.Metric{ID: "PollCount", MType: models.CounterMetricName}
+	gauge := models.Metric{ID: "Alloc", MType: models.GaugeMetricName, Value: &value}
+
+	mixed := o.Next([]models.Metric{gauge, counter})
+	gauges := o.Next([]models.Metric{gauge})
+	o.Requeue(mixed)
+	o.Requeue(gauges)
+	assert.Equal(t, []Batch{{AgentID: "agent", Seq: mixed.Seq, Metrics: []models.Metric{counter}, countersOnly: true}}, o.Pending(),
+		"gauges are not resent and a batch of gauges only is dropped")
+	assert.Len(t, mixed.Metrics, 2, "the original batch is not changed")
+}
+
+func TestBatch_IdempotencyKey(t *testing.T) {
+	o := NewOutbox("agent", DefaultOutboxLimit)
+	batch := o.Next([]models.Metric{{ID: "PollCount", MType: models.CounterMetricName}})
+	assert.Equal(t, "agent-1", batch.idempotencyKey())
+	o.Requeue(batch)
+	resent := o.Pending()[0]
+	assert.Equal(t, "agent-1-counters", resent.idempotencyKey(), "a requeued batch has a body of its own")
+	o.Requeue(resent)
+	assert.Equal(t, "agent-1-counters", o.Pending()[0].idempotencyKey(), "the key is kept on later resends")
+}
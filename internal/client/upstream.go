@@ -0,0 +1,431 @@
+package client
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	sdk "github.com/DenisPavlov/monitoring/client"
+	"github.com/DenisPavlov/monitoring/internal/logger"
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// Upstream modes of an agent reporting to several servers.
+const (
+	// ModeFailover sends every batch to the first available server.
+	ModeFailover = "failover"
+	// ModeFanout sends every batch to all servers.
+	ModeFanout = "fanout"
+)
+
+// UpstreamModes lists all supported upstream modes.
+var UpstreamModes = []string{ModeFailover, ModeFanout}
+
+const (
+	// failureThreshold is the number of consecutive failures opening the circuit of a server.
+	failureThreshold = 3
+	// probeInterval is the interval of recovery probes and fan-out resends.
+	probeInterval = 10 * time.Second
+	// probeTimeout limits a single recovery probe.
+	probeTimeout = 5 * time.Second
+)
+
+// postFunc sends a batch to a single server.
+type postFunc func(ctx context.Context, addr string, batch Batch) error
+
+// Upstream delivers batches to one or more servers.
+//
+// Upstream is also a collector reporting the state of every server, labeled with server:
+//   - UpstreamUp: 1 if the server accepted the last batch or probe, 0 otherwise (gauge)
+//   - UpstreamErrors: number of failed sends (counter)
+//   - UpstreamSignatureMismatches: number of responses with a missing or wrong signature (counter)
+//   - UpstreamQueueLength: number of batches waiting for the server (gauge, fan-out only)
+//   - UpstreamDropped: number of batches dropped from a full queue (counter, fan-out only)
+type Upstream interface {
+	// Send delivers a batch. An error means the batch was not acknowledged
+	// and should be resent later.
+	Send(ctx context.Context, batch Batch) error
+
+	// Run performs the background work of the upstream until ctx is done.
+	Run(ctx context.Context)
+
+	// Name returns "upstream".
+	Name() string
+
+	// Collect returns the state of the servers.
+	Collect(ctx context.Context) ([]models.Metric, error)
+}
+
+// NewUpstream creates the upstream of the given mode for the server addresses.
+// Batches are signed with signKey unless it is empty and encrypted with publicKey
+// unless it is nil. At most rateLimit requests are sent at the same time, which limits
+// the concurrent sends of the fan-out mode; values below 1 mean no limit.
+//
+// Returns an error for an unknown mode or an invalid address.
+func NewUpstream(mode string, addrs []string, signKey string, publicKey *rsa.PublicKey, rateLimit int) (Upstream, error) {
+	clients := make(map[string]*sdk.Client, len(addrs))
+	for _, addr := range addrs {
+		c, err := newServerClient(addr, signKey, publicKey, mode == ModeFailover)
+		if err != nil {
+			return nil, err
+		}
+		clients[addr] = c
+	}
+	post := func(ctx context.Context, addr string, batch Batch) error {
+		return postBatch(ctx, clients[addr], batch)
+	}
+	if rateLimit > 0 {
+		post = limitConcurrency(post, rateLimit)
+	}
+	switch mode {
+	case ModeFailover:
+		return newFailover(addrs, post), nil
+	case ModeFanout:
+		return newFanout(addrs, post, DefaultOutboxLimit), nil
+	default:
+		return nil, fmt.Errorf("unknown upstream mode %q, known modes: %v", mode, UpstreamModes)
+	}
+}
+
+// limitConcurrency returns a postFunc running at most limit calls of post at the same time.
+func limitConcurrency(post postFunc, limit int) postFunc {
+	sem := make(chan struct{}, limit)
+	return func(ctx context.Context, addr string, batch Batch) error {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-sem }()
+		return post(ctx, addr, batch)
+	}
+}
+
+// serverStats holds the counters of a server reported by Collect.
+type serverStats struct {
+	up         bool
+	errors     int64
+	mismatches int64
+	dropped    int64
+}
+
+// fail records a failed send to the server at addr. A response with an invalid
+// signature is logged, since it means the response was altered or the keys differ.
+func (s *serverStats) fail(addr string, err error) {
+	s.up = false
+	s.errors++
+	if errors.Is(err, sdk.ErrSignatureMismatch) {
+		s.mismatches++
+		logger.Log.Errorf("Response of server %s failed signature verification: %v", addr, err)
+	}
+}
+
+// collect returns the metrics of a server and resets its counters.
+func (s *serverStats) collect(addr string) []models.Metric {
+	labels := map[string]string{"server": addr}
+	up := 0.0
+	if s.up {
+		up = 1
+	}
+	errorsDelta, mismatches := s.errors, s.mismatches
+	s.errors, s.mismatches = 0, 0
+	return []models.Metric{
+		{ID: models.WithLabels("UpstreamUp", labels), MType: models.GaugeMetricName, Value: &up},
+		{ID: models.WithLabels("UpstreamErrors", labels), MType: models.CounterMetricName, Delta: &errorsDelta},
+		{ID: models.WithLabels("UpstreamSignatureMismatches", labels), MType: models.CounterMetricName, Delta: &mismatches},
+	}
+}
+
+// failoverServer is a server of Failover with its circuit breaker.
+type failoverServer struct {
+	addr     string
+	failures int
+	open     bool
+	stats    serverStats
+}
+
+// Failover sends every batch to the first server in order whose circuit is closed.
+//
+// After failureThreshold consecutive failures the circuit of a server opens and the
+// server is skipped. Run probes the /healthz endpoint of servers with an open circuit
+// and closes the circuit once a probe succeeds, so batches return to the preferred
+// server after it recovers. If all circuits are open, all servers are tried anyway.
+//
+// A batch whose response was lost is sent to the next server. It is applied once only
+// if the servers share a postgres database, where applied batches are recorded;
+// servers with in-memory storage do not know the batches applied by each other.
+type Failover struct {
+	servers []*failoverServer
+	post    postFunc
+	client  *http.Client
+
+	mu sync.Mutex
+}
+
+func newFailover(addrs []string, post postFunc) *Failover {
+	f := &Failover{post: post, client: &http.Client{Timeout: probeTimeout}}
+	for _, addr := range addrs {
+		f.servers = append(f.servers, &failoverServer{addr: addr, stats: serverStats{up: true}})
+	}
+	return f
+}
+
+// Send implements Upstream.
+func (f *Failover) Send(ctx context.Context, batch Batch) error {
+	var errs []error
+	for _, s := range f.candidates() {
+		err := f.post(ctx, s.addr, batch)
+		f.record(s, err)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("server %s: %w", s.addr, err))
+	}
+	return errors.Join(errs...)
+}
+
+// candidates returns the servers with a closed circuit, or all servers if every circuit is open.
+func (f *Failover) candidates() []*failoverServer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var closed []*failoverServer
+	for _, s := range f.servers {
+		if !s.open {
+			closed = append(closed, s)
+		}
+	}
+	if len(closed) == 0 {
+		return f.servers
+	}
+	return closed
+}
+
+// record updates the circuit of a server after a send.
+func (f *Failover) record(s *failoverServer, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err == nil {
+		if s.open {
+			logger.Log.Infof("Server %s recovered", s.addr)
+		}
+		s.failures, s.open, s.stats.up = 0, false, true
+		return
+	}
+	s.failures++
+	s.stats.fail(s.addr, err)
+	if !s.open && s.failures >= failureThreshold {
+		logger.Log.Errorf("Server %s failed %d times, circuit opened", s.addr, s.failures)
+		s.open = true
+	}
+}
+
+// Run probes the servers with an open circuit every probeInterval.
+func (f *Failover) Run(ctx context.Context) {
+	ticker := time.NewTicker(probeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			f.probe(ctx)
+		}
+	}
+}
+
+// probe checks the servers with an open circuit and closes the circuit of healthy ones.
+func (f *Failover) probe(ctx context.Context) {
+	f.mu.Lock()
+	var open []*failoverServer
+	for _, s := range f.servers {
+		if s.open {
+			open = append(open, s)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, s := range open {
+		if err := probeServer(ctx, f.client, s.addr); err != nil {
+			logger.Log.Infof("Recovery probe of server %s failed: %v", s.addr, err)
+			continue
+		}
+		f.record(s, nil)
+	}
+}
+
+// Name returns "upstream".
+func (f *Failover) Name() string {
+	return "upstream"
+}
+
+// Collect implements Upstream.
+func (f *Failover) Collect(_ context.Context) ([]models.Metric, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var batch []models.Metric
+	for _, s := range f.servers {
+		batch = append(batch, s.stats.collect(s.addr)...)
+	}
+	return batch, nil
+}
+
+// probeServer requests the liveness endpoint of a server.
+func probeServer(ctx context.Context, client *http.Client, addr string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/healthz", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+	return nil
+}
+
+// fanoutServer is a server of Fanout with its own queue of batches.
+type fanoutServer struct {
+	addr  string
+	queue []Batch
+	wake  chan struct{}
+	stats serverStats
+}
+
+// Fanout sends every batch to all servers.
+//
+// Every server has its own queue of at most limit batches, oldest dropped first,
+// and its own sender goroutine started by Run, so a slow or failed server does not
+// delay the others. A failed batch stays at the head of the queue and is resent
+// after probeInterval.
+type Fanout struct {
+	servers []*fanoutServer
+	post    postFunc
+	limit   int
+
+	mu sync.Mutex
+}
+
+func newFanout(addrs []string, post postFunc, limit int) *Fanout {
+	f := &Fanout{post: post, limit: limit}
+	for _, addr := range addrs {
+		f.servers = append(f.servers, &fanoutServer{
+			addr:  addr,
+			wake:  make(chan struct{}, 1),
+			stats: serverStats{up: true},
+		})
+	}
+	return f
+}
+
+// Send queues the batch for every server. It never fails.
+func (f *Fanout) Send(_ context.Context, batch Batch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.servers {
+		s.queue = append(s.queue, batch)
+		if drop := len(s.queue) - f.limit; drop > 0 {
+			logger.Log.Errorf("Dropping %d batches queued for server %s", drop, s.addr)
+			s.queue = s.queue[drop:]
+			s.stats.dropped += int64(drop)
+		}
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Run sends the queued batches to every server until ctx is done.
+func (f *Fanout) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, s := range f.servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.runServer(ctx, s)
+		}()
+	}
+	wg.Wait()
+}
+
+// runServer sends the queue of a single server.
+func (f *Fanout) runServer(ctx context.Context, s *fanoutServer) {
+	for {
+		batch, ok := f.pop(s)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+
+		err := f.post(ctx, s.addr, batch)
+		f.mu.Lock()
+		s.stats.up = err == nil
+		if err != nil {
+			s.stats.fail(s.addr, err)
+			if len(s.queue) < f.limit {
+				s.queue = append([]Batch{batch}, s.queue...)
+			} else {
+				s.stats.dropped++
+			}
+		}
+		f.mu.Unlock()
+		if err == nil {
+			continue
+		}
+
+		logger.Log.Errorf("Sending batch %d to server %s failed: %v", batch.Seq, s.addr, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(probeInterval):
+		}
+	}
+}
+
+// pop removes the oldest batch from the queue of a server.
+func (f *Fanout) pop(s *fanoutServer) (Batch, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(s.queue) == 0 {
+		return Batch{}, false
+	}
+	batch := s.queue[0]
+	s.queue = s.queue[1:]
+	return batch, true
+}
+
+// Name returns "upstream".
+func (f *Fanout) Name() string {
+	return "upstream"
+}
+
+// Collect implements Upstream.
+func (f *Fanout) Collect(_ context.Context) ([]models.Metric, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var batch []models.Metric
+	for _, s := range f.servers {
+		labels := map[string]string{"server": s.addr}
+		queued := float64(len(s.queue))
+		dropped := s.stats.dropped
+		s.stats.dropped = 0
+		batch = append(batch, s.stats.collect(s.addr)...)
+		batch = append(batch,
+			models.Metric{ID: models.WithLabels("UpstreamQueueLength", labels), MType: models.GaugeMetricName, Value: &queued},
+			models.Metric{ID: models.WithLabels("UpstreamDropped", labels), MType: models.CounterMetricName, Delta: &dropped},
+		)
+	}
+	return batch, nil
+}
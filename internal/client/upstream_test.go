@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	sdk "github.com/DenisPavlov/monitoring/client"
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/DenisPavlov/monitoring/internal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServers records the batches posted to every address and fails the addresses set in down.
+type fakeServers struct {
+	mu   sync.Mutex
+	down map[string]bool
+	got  map[string][]uint64
+}
+
+func newFakeServers() *fakeServers {
+	return &fakeServers{down: make(map[string]bool), got: make(map[string][]uint64)}
+}
+
+func (f *fakeServers) post(_ context.Context, addr string, batch Batch) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down[addr] {
+		return errors.New("connection refused")
+	}
+	f.got[addr] = append(f.got[addr], batch.Seq)
+	return nil
+}
+
+func (f *fakeServers) setDown(addr string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[addr] = down
+}
+
+func (f *fakeServers) received(addr string) []uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]uint64(nil), f.got[addr]...)
+}
+
+func metricsByID(batch []models.Metric) map[string]models.Metric {
+	byID := make(map[string]models.Metric, len(batch))
+	for _, m := range batch {
+		byID[m.ID] = m
+	}
+	return byID
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	servers := newFakeServers()
+	f := newFailover([]string{"a:1", "b:1"}, servers.post)
+
+	servers.setDown("a:1", true)
+	for seq := uint64(1); seq <= failureThreshold+1; seq++ {
+		assert.NoError(t, f.Send(ctx, Batch{Seq: seq}))
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4}, servers.received("b:1"))
+	assert.True(t, f.servers[0].open, "the circuit opens after consecutive failures")
+
+	got := metricsByID(mustCollect(t, f))
+	assert.Equal(t, 0.0, *got[`UpstreamUp{server="a:1"}`].Value)
+	assert.Equal(t, int64(failureThreshold), *got[`UpstreamErrors{server="a:1"}`].Delta)
+	assert.Equal(t, 1.0, *got[`UpstreamUp{server="b:1"}`].Value)
+
+	servers.setDown("b:1", true)
+	for seq := uint64(5); seq < 5+failureThreshold; seq++ {
+		assert.ErrorContains(t, f.Send(ctx, Batch{Seq: seq}), "server b:1")
+	}
+	err := f.Send(ctx, Batch{Seq: 8})
+	assert.ErrorContains(t, err, "server a:1", "all servers are tried when every circuit is open")
+	assert.ErrorContains(t, err, "server b:1")
+
+	servers.setDown("a:1", false)
+	assert.NoError(t, f.Send(ctx, Batch{Seq: 6}))
+	assert.False(t, f.servers[0].open)
+	assert.Equal(t, []uint64{6}, servers.received("a:1"))
+}
+
+func TestFailover_RecoveryProbe(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/healthz", r.URL.Path)
+	}))
+	defer healthy.Close()
+	addr := strings.TrimPrefix(healthy.URL, "http://")
+
+	f := newFailover([]string{addr, "127.0.0.1:1"}, newFakeServers().post)
+	f.servers[0].open = true
+	f.servers[1].open = true
+	f.probe(context.Background())
+	assert.False(t, f.servers[0].open, "a healthy server is closed again")
+	assert.True(t, f.servers[1].open)
+}
+
+func TestUpstream_SignatureMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(sdk.SignatureHeader, util.GetHexSHA256("other", nil))
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	u, err := NewUpstream(ModeFailover, []string{addr}, "secret", nil, 0)
+	assert.NoError(t, err)
+	err = u.Send(context.Background(), Batch{Seq: 1})
+	assert.ErrorIs(t, err, sdk.ErrSignatureMismatch, "a forged response is not an acknowledgement")
+
+	got := metricsByID(mustCollect(t, u))
+	assert.Equal(t, int64(1), *got[`UpstreamSignatureMismatches{server="`+addr+`"}`].Delta)
+	assert.Equal(t, int64(1), *got[`UpstreamErrors{server="`+addr+`"}`].Delta)
+	assert.Equal(t, int64(0), *metricsByID(mustCollect(t, u))[`UpstreamSignatureMismatches{server="`+addr+`"}`].Delta)
+}
+
+func TestFailover_NoRetries(t *testing.T) {
+	var primaryHits, secondaryHits atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryHits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryHits.Add(1)
+	}))
+	defer secondary.Close()
+
+	addrs := []string{strings.TrimPrefix(primary.URL, "http://"), strings.TrimPrefix(secondary.URL, "http://")}
+	u, err := NewUpstream(ModeFailover, addrs, "", nil, 0)
+	assert.NoError(t, err)
+	start := time.Now()
+	assert.NoError(t, u.Send(context.Background(), Batch{Seq: 1}))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), primaryHits.Load(), "a failed server is not retried in the failover mode")
+	assert.Equal(t, int32(1), secondaryHits.Load())
+}
+
+func TestFanout(t *testing.T) {
+	servers := newFakeServers()
+	servers.setDown("b:1", true)
+	f := newFanout([]string{"a:1", "b:1"}, servers.post, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		assert.NoError(t, f.Send(ctx, Batch{Seq: seq}))
+		assert.Eventually(t, func() bool { return len(servers.received("a:1")) == int(seq) }, time.Second, time.Millisecond)
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, servers.received("a:1"))
+
+	got := metricsByID(mustCollect(t, f))
+	assert.Equal(t, 0.0, *got[`UpstreamUp{server="b:1"}`].Value)
+	assert.Equal(t, 2.0, *got[`UpstreamQueueLength{server="b:1"}`].Value, "a failed server keeps its own queue")
+	assert.Equal(t, int64(1), *got[`UpstreamDropped{server="b:1"}`].Delta)
+	assert.Equal(t, int64(1), *got[`UpstreamErrors{server="b:1"}`].Delta)
+	assert.Equal(t, 0.0, *got[`UpstreamQueueLength{server="a:1"}`].Value)
+
+	cancel()
+	<-done
+}
+
+func TestNewUpstream(t *testing.T) {
+	_, err := NewUpstream("broadcast", []string{"a:1"}, "", nil, 0)
+	assert.ErrorContains(t, err, `unknown upstream mode "broadcast"`)
+	u, err := NewUpstream(ModeFanout, []string{"a:1"}, "", nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "upstream", u.Name())
+}
+
+func mustCollect(t *testing.T, u Upstream) []models.Metric {
+	t.Helper()
+	batch, err := u.Collect(context.Background())
+	assert.NoError(t, err)
+	return batch
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	post := limitConcurrency(func(context.Context, string, Batch) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}, 2)
+
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, post(context.Background(), "a:1", Batch{Seq: uint64(i)}))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), peak.Load())
+}
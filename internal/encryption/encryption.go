@@ -0,0 +1,153 @@
+// Package encryption implements hybrid encryption of request payloads.
+//
+// A payload is encrypted with a random AES-256-GCM key generated for every request,
+// and the key is wrapped with RSA-OAEP (SHA-256) using the public key of the server.
+// Only the holder of the private key can unwrap the key and decrypt the payload.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// keySize is the size of the AES-256 payload key in bytes.
+const keySize = 32
+
+// ErrDecrypt is returned when a payload cannot be decrypted, e.g. it was encrypted
+// for another key or altered.
+var ErrDecrypt = errors.New("cannot decrypt payload")
+
+// Encrypt encrypts plaintext with a new AES-256-GCM key wrapped with pub.
+//
+// Returns:
+//   - key: the payload key encrypted with RSA-OAEP
+//   - ciphertext: the GCM nonce followed by the sealed plaintext
+//   - err: if random bytes cannot be read or pub is too small to wrap the key
+func Encrypt(pub *rsa.PublicKey, plaintext []byte) (key, ciphertext []byte, err error) {
+	payloadKey := make([]byte, keySize)
+	if _, err := rand.Read(payloadKey); err != nil {
+		return nil, nil, err
+	}
+	gcm, err := newGCM(payloadKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	key, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, payloadKey, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("wrap payload key: %w", err)
+	}
+	return key, gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt unwraps the payload key with priv and decrypts the ciphertext produced
+// by Encrypt. Returns an error matching ErrDecrypt if either step fails.
+func Decrypt(priv *rsa.PrivateKey, key, ciphertext []byte) ([]byte, error) {
+	payloadKey, err := rsa.DecryptOAEP(sha256.New(), nil, priv, key, nil)
+	if err != nil || len(payloadKey) != keySize {
+		return nil, fmt.Errorf("%w: invalid payload key", ErrDecrypt)
+	}
+	gcm, err := newGCM(payloadKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecrypt)
+	}
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LoadPublicKey reads an RSA public key from a PEM file in PKIX ("PUBLIC KEY")
+// or PKCS #1 ("RSA PUBLIC KEY") format.
+func LoadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key %s: %w", path, err)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key %s: RSA key required, got %T", path, key)
+		}
+		return rsaKey, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key %s: %w", path, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("public key %s: unsupported PEM block %q", path, block.Type)
+	}
+}
+
+// LoadPrivateKey reads an RSA private key from a PEM file in PKCS #8 ("PRIVATE KEY")
+// or PKCS #1 ("RSA PRIVATE KEY") format.
+func LoadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key %s: %w", path, err)
+		}
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("private key %s: RSA key required, got %T", path, key)
+		}
+		return rsaKey, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse private key %s: %w", path, err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("private key %s: unsupported PEM block %q", path, block.Type)
+	}
+}
+
+// readPEM reads the first PEM block of a file.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
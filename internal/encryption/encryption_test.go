@@ -0,0 +1,84 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	plaintext := []byte(`[{"id":"c1","type":"counter","delta":3}]`)
+
+	key, ciphertext, err := Encrypt(&priv.PublicKey, plaintext)
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "counter")
+	got, err := Decrypt(priv, key, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, got)
+
+	_, again, err := Encrypt(&priv.PublicKey, plaintext)
+	require.NoError(t, err)
+	assert.NotEqual(t, ciphertext, again, "every payload uses a new key and nonce")
+
+	altered := append([]byte(nil), ciphertext...)
+	altered[len(altered)-1] ^= 1
+	_, err = Decrypt(priv, key, altered)
+	assert.ErrorIs(t, err, ErrDecrypt)
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, err = Decrypt(other, key, ciphertext)
+	assert.ErrorIs(t, err, ErrDecrypt)
+	_, err = Decrypt(priv, key, ciphertext[:4])
+	assert.ErrorIs(t, err, ErrDecrypt)
+}
+
+func TestLoadKeys(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	write := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+		return path
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pkix, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	for _, path := range []string{
+		write("pkcs8.pem", "PRIVATE KEY", pkcs8),
+		write("pkcs1.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv)),
+	} {
+		got, err := LoadPrivateKey(path)
+		require.NoError(t, err, path)
+		assert.True(t, priv.Equal(got), path)
+	}
+	for _, path := range []string{
+		write("pkix.pem", "PUBLIC KEY", pkix),
+		write("pkcs1.pub", "RSA PUBLIC KEY", x509.MarshalPKCS1PublicKey(&priv.PublicKey)),
+	} {
+		got, err := LoadPublicKey(path)
+		require.NoError(t, err, path)
+		assert.True(t, priv.PublicKey.Equal(got), path)
+	}
+
+	_, err = LoadPublicKey(write("wrong.pem", "CERTIFICATE", []byte{1}))
+	assert.ErrorContains(t, err, `unsupported PEM block "CERTIFICATE"`)
+	_, err = LoadPrivateKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+	empty := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a key"), 0600))
+	_, err = LoadPrivateKey(empty)
+	assert.ErrorContains(t, err, "no PEM data found")
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/DenisPavlov/monitoring/internal/encryption"
+	"github.com/DenisPavlov/monitoring/internal/logger"
+)
+
+// EncryptedKeyHeaderName is the HTTP header with the base64 payload key of an
+// encrypted request body, wrapped with the public key of the server (see encryption.Encrypt).
+const EncryptedKeyHeaderName = "X-Encrypted-Key"
+
+// maxEncryptedBodySize limits the size of an encrypted request body, which is read
+// into memory as a whole before it is decrypted.
+const maxEncryptedBodySize = 16 << 20
+
+// DecryptMiddleware decrypts the bodies of requests with the EncryptedKeyHeaderName
+// header using the private key of the server. Requests without the header are passed
+// through, so encryption stays optional for clients.
+//
+// The middleware must run before GzipMiddleware, since clients compress the body
+// before encrypting it, and before signature verification, since signatures cover
+// the plain body.
+//
+// Responds with HTTP 400 if the body cannot be decrypted, if the wrapped key does not
+// match the size of priv or if priv is nil and the request is encrypted, and with
+// HTTP 413 if the body exceeds 16 MiB.
+func DecryptMiddleware(priv *rsa.PrivateKey) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encodedKey := r.Header.Get(EncryptedKeyHeaderName)
+			if encodedKey == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if priv == nil {
+				http.Error(w, "encrypted requests are not supported", http.StatusBadRequest)
+				return
+			}
+
+			// The wrapped key is exactly as long as the RSA modulus; longer values are
+			// rejected before decoding them.
+			if len(encodedKey) > base64.StdEncoding.EncodedLen(priv.Size()) {
+				http.Error(w, "invalid "+EncryptedKeyHeaderName+" header", http.StatusBadRequest)
+				return
+			}
+			key, err := base64.StdEncoding.DecodeString(encodedKey)
+			if err != nil || len(key) != priv.Size() {
+				http.Error(w, "invalid "+EncryptedKeyHeaderName+" header", http.StatusBadRequest)
+				return
+			}
+			ciphertext, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEncryptedBodySize))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body, err := encryption.Decrypt(priv, key, ciphertext)
+			if err != nil {
+				logger.Log.Infof("Rejected encrypted request %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, encryption.ErrDecrypt.Error(), http.StatusBadRequest)
+				return
+			}
+
+			r.Header.Del(EncryptedKeyHeaderName)
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
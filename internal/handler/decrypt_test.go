@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/encryption"
+	"github.com/DenisPavlov/monitoring/internal/models"
+	storage2 "github.com/DenisPavlov/monitoring/internal/storage"
+	"github.com/DenisPavlov/monitoring/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecryptMiddleware(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	const signKey = "secret"
+	storage := storage2.NewMemStorage()
+	srv := httptest.NewServer(BuildRouter(storage, nil, signKey, WithPrivateKey(priv)))
+	defer srv.Close()
+	plain := httptest.NewServer(BuildRouter(storage2.NewMemStorage(), nil, ""))
+	defer plain.Close()
+
+	body := []byte(`[{"id":"c1","type":"counter","delta":3}]`)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, err = zw.Write(body)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	send := func(url string, sign bool, key, payload []byte) int {
+		req, err := http.NewRequest(http.MethodPost, url+"/updates/", bytes.NewReader(payload))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		req.Header.Set(EncryptedKeyHeaderName, base64.StdEncoding.EncodeToString(key))
+		if sign {
+			timestamp, nonce := strconv.FormatInt(time.Now().Unix(), 10), "n-"+strconv.Itoa(len(payload))
+			req.Header.Set(SignatureVersionHeaderName, SignatureVersion)
+			req.Header.Set(SignatureTimestampHeaderName, timestamp)
+			req.Header.Set(SignatureNonceHeaderName, nonce)
+			req.Header.Set(SHA256HeaderName, util.GetHexSHA256Request(signKey, http.MethodPost, "/updates/", timestamp, nonce, body))
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	key, ciphertext, err := encryption.Encrypt(&priv.PublicKey, compressed.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, send(srv.URL, true, key, ciphertext), "the signature is verified after decryption")
+	saved, err := storage.GetByTypeAndID(context.Background(), "c1", models.CounterMetricName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *saved.Delta)
+
+	altered := append([]byte(nil), ciphertext...)
+	altered[len(altered)-1] ^= 1
+	assert.Equal(t, http.StatusBadRequest, send(srv.URL, false, key, altered))
+	assert.Equal(t, http.StatusBadRequest, send(srv.URL, false, []byte("garbage"), ciphertext))
+	assert.Equal(t, http.StatusBadRequest, send(plain.URL, false, key, ciphertext),
+		"encrypted requests are rejected without a private key")
+}
+
+func TestDecryptMiddleware_Limits(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	handler := DecryptMiddleware(priv)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	key, _, err := encryption.Encrypt(&priv.PublicKey, []byte("{}"))
+	require.NoError(t, err)
+
+	serve := func(key []byte, bodySize int) int {
+		req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(make([]byte, bodySize)))
+		req.Header.Set(EncryptedKeyHeaderName, base64.StdEncoding.EncodeToString(key))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, serve(make([]byte, 64*priv.Size()), 64), "oversized keys are not decrypted")
+	assert.Equal(t, http.StatusBadRequest, serve(key[:len(key)-1], 64))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(key, maxEncryptedBodySize+1))
+}
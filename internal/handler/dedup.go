@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// Headers identifying a batch sent to /updates/. Batches without them are always applied.
+const (
+	// AgentIDHeaderName is the HTTP header with the unique ID of the sending agent.
+	AgentIDHeaderName = "X-Agent-ID"
+	// BatchSeqHeaderName is the HTTP header with the sequence number of the batch
+	// within its agent.
+	BatchSeqHeaderName = "X-Batch-Seq"
+)
+
+const (
+	// dedupWindow is the number of recent sequence numbers remembered per agent.
+	// Older batches are considered applied.
+	dedupWindow = 1024
+	// dedupAgentTTL is how long the sequence numbers of a silent agent are kept.
+	dedupAgentTTL = 24 * time.Hour
+)
+
+// agentSeqs holds the recent sequence numbers of an agent.
+type agentSeqs struct {
+	maxSeq uint64
+	// seen maps a sequence number to true once the batch is applied
+	// and to false while it is being applied.
+	seen     map[uint64]bool
+	lastSeen time.Time
+}
+
+// BatchDeduplicator drops repeated batches of agents, so an agent can resend a batch
+// whose response it did not receive without counter deltas being applied twice.
+//
+// Batches may arrive out of order: the last dedupWindow sequence numbers of every
+// agent are remembered individually. Agents silent for dedupAgentTTL are forgotten,
+// so a restarted agent must use a new ID.
+//
+// The sequence numbers are kept in memory of every server. With the postgres storage
+// applied batches are also recorded in the database in the transaction saving their
+// metrics (see storage.ContextWithBatch), so a batch is applied once across restarts
+// and across servers sharing the database. With other storages a batch applied before
+// a restart, or by another server after a failover, is applied again when the agent
+// resends it because the response was lost.
+type BatchDeduplicator struct {
+	mu        sync.Mutex
+	agents    map[string]*agentSeqs
+	now       func() time.Time
+	lastPrune time.Time
+}
+
+// NewBatchDeduplicator creates an empty in-memory deduplicator.
+func NewBatchDeduplicator() *BatchDeduplicator {
+	return &BatchDeduplicator{
+		agents: make(map[string]*agentSeqs),
+		now:    time.Now,
+	}
+}
+
+// Begin reserves a batch for applying.
+//
+// Returns:
+//   - applied: the batch was applied before and must be skipped
+//   - inflight: the same batch is being applied by another request
+//
+// If both are false, the caller must report the outcome with Done.
+func (d *BatchDeduplicator) Begin(agentID string, seq uint64) (applied, inflight bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.prune(now)
+	a, ok := d.agents[agentID]
+	if !ok {
+		a = &agentSeqs{seen: make(map[uint64]bool)}
+		d.agents[agentID] = a
+	}
+	a.lastSeen = now
+
+	if a.maxSeq >= dedupWindow && seq <= a.maxSeq-dedupWindow {
+		return true, false
+	}
+	if done, ok := a.seen[seq]; ok {
+		return done, !done
+	}
+	a.seen[seq] = false
+	return false, false
+}
+
+// Done records the outcome of a batch reserved with Begin. A batch that was not
+// applied is forgotten, so it is applied when the agent resends it.
+func (d *BatchDeduplicator) Done(agentID string, seq uint64, applied bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	a, ok := d.agents[agentID]
+	if !ok {
+		return
+	}
+	if !applied {
+		delete(a.seen, seq)
+		return
+	}
+	a.seen[seq] = true
+	if seq <= a.maxSeq {
+		return
+	}
+	a.maxSeq = seq
+	if a.maxSeq < dedupWindow {
+		return
+	}
+	for s := range a.seen {
+		if s <= a.maxSeq-dedupWindow {
+			delete(a.seen, s)
+		}
+	}
+}
+
+// prune forgets the agents silent for dedupAgentTTL, at most once per hour.
+func (d *BatchDeduplicator) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < time.Hour {
+		return
+	}
+	d.lastPrune = now
+	for id, a := range d.agents {
+		if now.Sub(a.lastSeen) > dedupAgentTTL {
+			delete(d.agents, id)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	storage2 "github.com/DenisPavlov/monitoring/internal/storage"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchDeduplicator(t *testing.T) {
+	d := NewBatchDeduplicator()
+
+	applied, inflight := d.Begin("a1", 1)
+	assert.False(t, applied)
+	assert.False(t, inflight)
+	_, inflight = d.Begin("a1", 1)
+	assert.True(t, inflight, "the batch is being applied")
+
+	d.Done("a1", 1, false)
+	applied, inflight = d.Begin("a1", 1)
+	assert.False(t, applied || inflight, "a failed batch is applied when resent")
+	d.Done("a1", 1, true)
+	applied, _ = d.Begin("a1", 1)
+	assert.True(t, applied)
+
+	applied, _ = d.Begin("a2", 1)
+	assert.False(t, applied, "sequence numbers are per agent")
+}
+
+func TestBatchDeduplicator_Window(t *testing.T) {
+	d := NewBatchDeduplicator()
+	for _, seq := range []uint64{2, 1, dedupWindow + 5} {
+		d.Begin("a1", seq)
+		d.Done("a1", seq, true)
+	}
+	applied, _ := d.Begin("a1", 3)
+	assert.True(t, applied, "batches older than the window are considered applied")
+	applied, _ = d.Begin("a1", 100)
+	assert.False(t, applied, "batches may arrive out of order")
+	assert.Len(t, d.agents["a1"].seen, 2)
+}
+
+func TestBatchDeduplicator_Prune(t *testing.T) {
+	now := time.Now()
+	d := NewBatchDeduplicator()
+	d.now = func() time.Time { return now }
+	d.Begin("a1", 1)
+	d.Done("a1", 1, true)
+
+	now = now.Add(dedupAgentTTL + time.Hour)
+	d.Begin("a2", 1)
+	assert.NotContains(t, d.agents, "a1")
+}
+
+func TestUpdatesDuplicateBatch(t *testing.T) {
+	storage := storage2.NewMemStorage()
+	srv := httptest.NewServer(BuildRouter(storage, nil, ""))
+	defer srv.Close()
+
+	send := func(seq string) *resty.Response {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetHeader(AgentIDHeaderName, "agent").
+			SetHeader(BatchSeqHeaderName, seq).
+			SetBody(`[{"id":"PollCount","type":"counter","delta":5}]`).
+			Post(srv.URL + "/updates/")
+		assert.NoError(t, err, "error making HTTP request")
+		return resp
+	}
+
+	assert.Equal(t, http.StatusOK, send("1").StatusCode())
+	assert.Equal(t, http.StatusOK, send("1").StatusCode())
+	assert.Equal(t, http.StatusOK, send("2").StatusCode())
+	assert.Equal(t, http.StatusBadRequest, send("x").StatusCode())
+
+	resp, err := resty.New().R().
+		SetHeader("Accept-Encoding", "").
+		Get(srv.URL + getBasePath + "/counter/PollCount")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, "10", string(resp.Body()))
+}
+
+// appliedStorage reports every batch as applied by another server.
+type appliedStorage struct {
+	*storage2.MemoryMetricsStorage
+}
+
+func (s appliedStorage) SaveAll(context.Context, []models.Metric) error {
+	return storage2.ErrBatchApplied
+}
+
+func TestUpdatesBatchAppliedElsewhere(t *testing.T) {
+	srv := httptest.NewServer(BuildRouter(appliedStorage{storage2.NewMemStorage()}, nil, ""))
+	defer srv.Close()
+
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetHeader(AgentIDHeaderName, "agent").
+		SetHeader(BatchSeqHeaderName, "1").
+		SetBody(`[{"id":"PollCount","type":"counter","delta":5}]`).
+		Post(srv.URL + "/updates/")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), "a batch applied by another server is acknowledged")
+}
@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/DenisPavlov/monitoring/internal/health"
+	"github.com/DenisPavlov/monitoring/internal/logger"
+)
+
+// healthHandler returns a handler running all registered checks of the given kind.
+//
+// The response body is the JSON encoded health.Report, for example:
+//
+//	{"status":"failed","checks":[{"name":"postgres","status":"failed","error":"connection refused","duration":"1ms"}]}
+//
+// Returns:
+//   - HTTP 200 if all checks passed
+//   - HTTP 503 if any check failed
+func healthHandler(registry *health.Registry, kind health.Kind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := registry.Run(r.Context(), kind)
+
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Log.Error("cannot encode health report JSON body", err)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/DenisPavlov/monitoring/internal/idempotency"
+	"github.com/DenisPavlov/monitoring/internal/logger"
+)
+
+const (
+	// IdempotencyKeyHeaderName is the HTTP header with the client-generated key of a request.
+	// Repeated requests with the same key are applied once.
+	IdempotencyKeyHeaderName = "Idempotency-Key"
+	// IdempotentReplayedHeaderName is set to "true" on responses returned from a saved result.
+	IdempotentReplayedHeaderName = "Idempotent-Replayed"
+)
+
+var _ http.ResponseWriter = (*recordingWriter)(nil)
+
+// recordingWriter wraps http.ResponseWriter to record the response status and body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code and delegates to the underlying ResponseWriter.
+func (w *recordingWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write records the body and delegates to the underlying ResponseWriter.
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware applies requests with the IdempotencyKeyHeaderName header
+// at most once and returns the saved result for repeats.
+//
+// Keys are scoped by request path. Requests without the header are passed through.
+//
+// Returns:
+//   - the saved response with the IdempotentReplayedHeaderName header for a repeated key
+//   - HTTP 409 while a request with the same key is being applied
+//   - HTTP 422 if the key was used for a request with another method or body
+//
+// Responses with status >= 500 are not saved, so the request can be retried.
+//
+// With an idempotency.TxStore, a storage sharing its database completes the key in
+// the transaction saving the metrics, so a crash after the commit does not release
+// the key and the request is not applied twice.
+//
+// On /updates/ batches with the agent ID and sequence headers are also deduplicated by
+// BatchDeduplicator, which runs after this middleware. The agent sends both: the key
+// "AgentID-Seq" (with a "-counters" suffix for a batch resent without its gauges) is
+// checked first and returns the saved response of an applied batch; the sequence number
+// additionally drops a batch whose key expired or was released.
+//
+// Parameters:
+//   - store: Store of idempotency keys
+//
+// Returns:
+//   - func(http.Handler) http.Handler: Chi middleware function
+func IdempotencyMiddleware(store idempotency.Store) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeaderName)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key = r.URL.Path + " " + key
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			hash := sha256.New()
+			hash.Write([]byte(r.Method + "\n"))
+			hash.Write(body)
+
+			saved, err := store.Begin(r.Context(), key, hex.EncodeToString(hash.Sum(nil)))
+			switch {
+			case errors.Is(err, idempotency.ErrInProgress):
+				w.WriteHeader(http.StatusConflict)
+				return
+			case errors.Is(err, idempotency.ErrMismatch):
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				return
+			case err != nil:
+				logger.Log.Error("cannot reserve idempotency key", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			case saved != nil:
+				if saved.ContentType != "" {
+					w.Header().Set("Content-Type", saved.ContentType)
+				}
+				w.Header().Set(IdempotentReplayedHeaderName, "true")
+				w.WriteHeader(saved.Status)
+				_, _ = w.Write(saved.Body)
+				return
+			}
+
+			if txStore, ok := store.(idempotency.TxStore); ok {
+				r = r.WithContext(idempotency.ContextWithKey(r.Context(), txStore, key))
+			}
+			rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+
+			// The request context may be canceled once the response is written.
+			ctx := context.WithoutCancel(r.Context())
+			if rw.status >= http.StatusInternalServerError {
+				err = store.Release(ctx, key)
+			} else {
+				err = store.Complete(ctx, key, idempotency.Result{
+					Status:      rw.status,
+					ContentType: rw.Header().Get("Content-Type"),
+					Body:        rw.body.Bytes(),
+				})
+			}
+			if err != nil {
+				logger.Log.Error("cannot save idempotency key", err)
+			}
+		})
+	}
+}
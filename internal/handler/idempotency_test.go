@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	storage2 "github.com/DenisPavlov/monitoring/internal/storage"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	storage := storage2.NewMemStorage()
+	srv := httptest.NewServer(BuildRouter(storage, nil, ""))
+	defer srv.Close()
+
+	send := func(path, key, body string) *resty.Response {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetHeader("Accept-Encoding", "").
+			SetHeader(IdempotencyKeyHeaderName, key).
+			SetBody(body).
+			Post(srv.URL + path)
+		assert.NoError(t, err, "error making HTTP request")
+		return resp
+	}
+
+	batch := `[{"id":"c1","type":"counter","delta":3}]`
+	resp := send("/updates/", "k1", batch)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Empty(t, resp.Header().Get(IdempotentReplayedHeaderName))
+	resp = send("/updates/", "k1", batch)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, "true", resp.Header().Get(IdempotentReplayedHeaderName))
+	assert.Equal(t, http.StatusUnprocessableEntity, send("/updates/", "k1", `[]`).StatusCode())
+
+	metric := `{"id":"c1","type":"counter","delta":1}`
+	first := send(updateBasePath+"/", "k2", metric)
+	assert.Equal(t, http.StatusOK, first.StatusCode())
+	repeat := send(updateBasePath+"/", "k2", metric)
+	assert.Equal(t, string(first.Body()), string(repeat.Body()), "the original result is returned")
+	assert.Equal(t, first.Header().Get("Content-Type"), repeat.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusOK, send(updateBasePath+"/", "k3", metric).StatusCode(), "keys are independent")
+
+	resp, err := resty.New().R().
+		SetHeader("Accept-Encoding", "").
+		Get(srv.URL + getBasePath + "/counter/c1")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, "5", string(resp.Body()))
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceCache remembers the nonces of signed requests until their timestamps leave
+// the signature window, so a request cannot be replayed while it would be accepted.
+type nonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expires: make(map[string]time.Time)}
+}
+
+// add records the nonce until expires and reports whether it was not used before.
+func (c *nonceCache) add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.prune(now)
+	if exp, ok := c.expires[nonce]; ok && now.Before(exp) {
+		return false
+	}
+	c.expires[nonce] = expires
+	return true
+}
+
+// prune removes expired nonces at most once per minute.
+func (c *nonceCache) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < time.Minute {
+		return
+	}
+	c.lastPrune = now
+	for nonce, exp := range c.expires {
+		if !now.Before(exp) {
+			delete(c.expires, nonce)
+		}
+	}
+}
@@ -2,14 +2,18 @@ package handler
 
 import (
 	"context"
+	"crypto/rsa"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strconv"
 	"time"
 
+	"github.com/DenisPavlov/monitoring/internal/health"
+	"github.com/DenisPavlov/monitoring/internal/idempotency"
 	"github.com/DenisPavlov/monitoring/internal/logger"
 	"github.com/DenisPavlov/monitoring/internal/models"
 	"github.com/DenisPavlov/monitoring/internal/storage"
@@ -22,49 +26,157 @@ const (
 	getBasePath    = "/value"
 )
 
+// routerOptions holds optional router settings configured with Option functions.
+type routerOptions struct {
+	selfMetrics storage.MetricsStorage
+	health      *health.Registry
+	keyProvider func() string
+	legacySign  bool
+	privateKey  *rsa.PrivateKey
+	idempotency idempotency.Store
+}
+
+// Option configures optional router behaviour in BuildRouter.
+type Option func(*routerOptions)
+
+// WithSelfMetrics enables recording of per-route request counts and latencies
+// into the given storage (see HTTPMetricsMiddleware).
+func WithSelfMetrics(self storage.MetricsStorage) Option {
+	return func(o *routerOptions) {
+		o.selfMetrics = self
+	}
+}
+
+// WithHealth sets the check registry used by the /healthz and /readyz endpoints.
+// Without it both endpoints report healthy with an empty list of checks.
+func WithHealth(registry *health.Registry) Option {
+	return func(o *routerOptions) {
+		o.health = registry
+	}
+}
+
+// WithKeyProvider makes the router read the signing key from the provider on every
+// request instead of using the fixed signKey, so the key can be changed at runtime.
+func WithKeyProvider(provider func() string) Option {
+	return func(o *routerOptions) {
+		o.keyProvider = provider
+	}
+}
+
+// WithLegacySignatures makes the router accept requests signed with version 1 of the
+// signing scheme, which covers the body only (see AcceptLegacySignatures), as well as
+// unsigned updates, which are otherwise rejected while a key is set
+// (see RequireSignatureMiddlewareFunc).
+func WithLegacySignatures(enabled bool) Option {
+	return func(o *routerOptions) {
+		o.legacySign = enabled
+	}
+}
+
+// WithPrivateKey makes the router decrypt request bodies encrypted with the matching
+// public key (see DecryptMiddleware). Without it encrypted requests are rejected.
+func WithPrivateKey(key *rsa.PrivateKey) Option {
+	return func(o *routerOptions) {
+		o.privateKey = key
+	}
+}
+
+// WithIdempotencyStore sets the store of idempotency keys used by the update endpoints.
+// Without it keys are kept in memory for idempotency.DefaultTTL.
+func WithIdempotencyStore(store idempotency.Store) Option {
+	return func(o *routerOptions) {
+		o.idempotency = store
+	}
+}
+
 // BuildRouter constructs and configures the chi router with all application routes.
 //
 // The router includes middleware for:
 //   - Request logging
+//   - Per-route request counts and latencies (if WithSelfMetrics is provided)
+//   - SHA256 response signing of the body as sent (if signKey or WithKeyProvider is provided)
+//   - Decryption of encrypted request bodies (see WithPrivateKey)
 //   - Gzip compression/decompression
-//   - SHA256 signature verification (if signKey is provided)
+//   - SHA256 request signature verification (if signKey or WithKeyProvider is provided);
+//     unsigned requests to /update/ and /updates/ are rejected while a key is set
 //   - 60-second request timeout
+//   - Idempotency keys on the update endpoints (see IdempotencyMiddleware)
 //
 // Routes configured:
 //   - POST /update/ - Update metric via JSON
 //   - POST /update/{mType}/{mName}/{mValue} - Update metric via URL parameters
+//   - GET /value/ - Get all metrics as JSON array
 //   - POST /value/ - Get metric via JSON request
 //   - GET /value/{mType}/{mName} - Get metric via URL parameters
 //   - GET /ping - Database health check
+//   - GET /healthz - Liveness checks as JSON report
+//   - GET /readyz - Readiness checks as JSON report
 //   - POST /updates/ - Batch update multiple metrics
 //   - GET / - Get all metrics as HTML page
+//   - GET /metrics - Get all metrics in Prometheus text format
 //
 // Parameters:
 //   - storage: MetricsStorage implementation for data persistence
-//   - db: Database connection for health checks
-//   - signKey: Cryptographic key for request signature verification (empty disables)
+//   - db: Database connection for /ping (nil if no database is configured)
+//   - signKey: Cryptographic key for request verification and response signing (empty disables)
+//   - opts: Optional router settings
 //
 // Returns:
 //   - chi.Router: Configured router with all middleware and routes
-func BuildRouter(storage storage.MetricsStorage, db *sql.DB, signKey string) chi.Router {
+func BuildRouter(storage storage.MetricsStorage, db *sql.DB, signKey string, opts ...Option) chi.Router {
+	var o routerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.health == nil {
+		o.health = health.NewRegistry()
+	}
+	if o.idempotency == nil {
+		o.idempotency = idempotency.NewMemoryStore(idempotency.DefaultTTL)
+	}
+	idempotent := IdempotencyMiddleware(o.idempotency)
+
 	r := chi.NewRouter()
 	r.Use(logger.RequestLogger)
+	if o.selfMetrics != nil {
+		r.Use(HTTPMetricsMiddleware(o.selfMetrics))
+	}
+	keyProvider := o.keyProvider
+	if keyProvider == nil && signKey != "" {
+		keyProvider = func() string { return signKey }
+	}
+	// Responses are signed after compression and requests are verified after decompression.
+	if keyProvider != nil {
+		r.Use(SHA256ResponseSignMiddlewareFunc(keyProvider))
+	}
+	r.Use(DecryptMiddleware(o.privateKey))
 	r.Use(GzipMiddleware)
-	if signKey != "" {
-		r.Use(SHA256SignMiddleware(signKey))
+	if keyProvider != nil {
+		r.Use(SHA256VerifyMiddlewareFunc(keyProvider, AcceptLegacySignatures(o.legacySign)))
 	}
 	r.Use(middleware.Timeout(60 * time.Second))
+	// Mutating endpoints require a signature while a key is set, unless legacy
+	// signatures are accepted for clients that do not sign every request yet.
+	requireSigned := func(next http.Handler) http.Handler { return next }
+	if keyProvider != nil && !o.legacySign {
+		requireSigned = RequireSignatureMiddlewareFunc(keyProvider)
+	}
 	r.Route(updateBasePath, func(r chi.Router) {
+		r.Use(requireSigned, idempotent)
 		r.Post("/", updateMetricHandler(storage))
 		r.Post("/{mType}/{mName}/{mValue}", saveMetricsHandler(storage))
 	})
 	r.Route(getBasePath, func(r chi.Router) {
+		r.Get("/", listMetricsHandler(storage))
 		r.Post("/", getJSONMetricHandler(storage))
 		r.Get("/{mType}/{mName}", getMetricHandler(storage))
 	})
 	r.Get("/ping", pingDBHandler(db))
-	r.Post("/updates/", updatesHandler(storage))
+	r.Get("/healthz", healthHandler(o.health, health.Liveness))
+	r.Get("/readyz", healthHandler(o.health, health.Readiness))
+	r.With(requireSigned, idempotent).Post("/updates/", updatesHandler(storage, NewBatchDeduplicator()))
 	r.Get("/", getAllMetricsHandler(storage))
+	r.Get("/metrics", prometheusMetricsHandler(storage))
 	return r
 }
 
@@ -72,15 +184,21 @@ func BuildRouter(storage storage.MetricsStorage, db *sql.DB, signKey string) chi
 //
 // The handler pings the database with a 1-second timeout and returns:
 //   - HTTP 200 if the database is reachable
-//   - HTTP 500 if the database connection fails
+//   - HTTP 500 if the database connection fails or no database is configured
 func pingDBHandler(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		if db == nil {
+			logger.Log.Error("Error pinging database: database is not configured")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 		defer cancel()
 
 		defer func() {
-			if err := recover(); r != nil {
-				logger.Log.Error("Error pinging database: ", err)
+			if rec := recover(); rec != nil {
+				logger.Log.Error("Error pinging database: ", rec)
 				w.WriteHeader(http.StatusInternalServerError)
 			}
 		}()
@@ -209,17 +327,53 @@ func getJSONMetricHandler(storage storage.MetricsStorage) http.HandlerFunc {
 	}
 }
 
+// listMetricsHandler returns a handler for retrieving all metrics as JSON.
+//
+// Response body format: array of Metric objects, gauges first
+//
+//	[{"id": "name1", "type": "gauge", "value": 1.23}, {"id": "name2", "type": "counter", "delta": 5}]
+//
+// Returns:
+//   - HTTP 500 for storage errors
+//   - HTTP 200 with metrics in JSON format
+func listMetricsHandler(storage storage.MetricsStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := make([]models.Metric, 0)
+		for _, mType := range []string{models.GaugeMetricName, models.CounterMetricName} {
+			metrics, err := storage.GetAllByType(r.Context(), mType)
+			if err != nil {
+				logger.Log.Errorf("Can not get all %s metrics: %s", mType, err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			res = append(res, metrics...)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			logger.Log.Error("cannot encode metrics JSON body", err)
+			return
+		}
+	}
+}
+
 // updatesHandler returns a handler for batch updating multiple metrics.
 //
 // Expected JSON request body format: array of Metric objects
 //
 //	[{"id": "name1", "mType": "gauge", "value": 1.23}, ...]
 //
+// A batch with the AgentIDHeaderName and BatchSeqHeaderName headers is applied
+// at most once; a repeated batch is acknowledged without saving it again. The batch
+// is remembered by dedup and, for a storage shared by several servers, recorded by
+// the storage itself (see storage.ContextWithBatch).
+//
 // Returns:
-//   - HTTP 400 for invalid JSON
+//   - HTTP 400 for invalid JSON or sequence number, or a reserved metric ID
+//   - HTTP 409 if the same batch is being saved by another request
 //   - HTTP 500 for storage errors
-//   - HTTP 200 on successful batch save
-func updatesHandler(storage storage.MetricsStorage) http.HandlerFunc {
+//   - HTTP 200 on successful batch save or for an already saved batch
+func updatesHandler(store storage.MetricsStorage, dedup *BatchDeduplicator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req []models.Metric
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -227,14 +381,54 @@ func updatesHandler(storage storage.MetricsStorage) http.HandlerFunc {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if err := storage.SaveAll(r.Context(), req); err != nil {
+
+		agentID := r.Header.Get(AgentIDHeaderName)
+		if agentID != "" {
+			seq, err := strconv.ParseUint(r.Header.Get(BatchSeqHeaderName), 10, 64)
+			if err != nil {
+				logger.Log.Error("invalid batch sequence number", err)
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			applied, inflight := dedup.Begin(agentID, seq)
+			switch {
+			case applied:
+				logger.Log.Infof("skipping duplicate batch %d of agent %s", seq, agentID)
+				return
+			case inflight:
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			err = store.SaveAll(storage.ContextWithBatch(r.Context(), agentID, seq), req)
+			if errors.Is(err, storage.ErrBatchApplied) {
+				logger.Log.Infof("skipping batch %d of agent %s applied by another server", seq, agentID)
+				err = nil
+			}
+			dedup.Done(agentID, seq, err == nil)
+			if err != nil {
+				logger.Log.Error("cannot save metrics to storage", err)
+				w.WriteHeader(saveErrorStatus(err))
+			}
+			return
+		}
+
+		if err := store.SaveAll(r.Context(), req); err != nil {
 			logger.Log.Error("cannot save metrics to storage", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			w.WriteHeader(saveErrorStatus(err))
 			return
 		}
 	}
 }
 
+// saveErrorStatus returns the response status of a failed SaveAll: HTTP 400 for
+// reserved metric IDs and HTTP 500 otherwise.
+func saveErrorStatus(err error) int {
+	if errors.Is(err, storage.ErrReservedID) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 // getAllMetricsHandler returns a handler for retrieving all metrics as HTML.
 //
 // Returns an HTML page displaying all gauge and counter metrics with their values.
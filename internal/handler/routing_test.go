@@ -1,11 +1,15 @@
 package handler
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
+	"github.com/DenisPavlov/monitoring/internal/health"
 	"github.com/DenisPavlov/monitoring/internal/models"
 	storage2 "github.com/DenisPavlov/monitoring/internal/storage"
 
@@ -102,3 +106,145 @@ func TestGet(t *testing.T) {
 	assert.NoError(t, err, "error making HTTP request")
 	assert.Equal(t, "2", string(resp.Body()))
 }
+
+func BenchmarkUpdatesHandlerParallel(b *testing.B) {
+	var storage = storage2.NewMemStorage()
+	router := BuildRouter(storage, nil, "")
+
+	var metrics []models.Metric
+	for i := 0; i < 40; i++ {
+		v := float64(i)
+		metrics = append(metrics, models.Metric{ID: "gauge" + strconv.Itoa(i), MType: models.GaugeMetricName, Value: &v})
+	}
+	d := int64(1)
+	metrics = append(metrics, models.Metric{ID: "PollCount", MType: models.CounterMetricName, Delta: &d})
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest(http.MethodPost, "/updates/", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Fatalf("unexpected status %d", w.Code)
+			}
+		}
+	})
+}
+
+func TestSelfMetrics(t *testing.T) {
+	self := storage2.NewMemStorage()
+	storage := storage2.NewInstrumentedStorage(storage2.NewMemStorage(), self)
+	srv := httptest.NewServer(BuildRouter(storage, nil, "", WithSelfMetrics(self)))
+	defer srv.Close()
+
+	resp, err := resty.New().R().Post(srv.URL + updateBasePath + "/counter/c1/5")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	resp, err = resty.New().R().
+		SetHeader("Accept-Encoding", "").
+		Get(srv.URL + getBasePath + "/counter/server_http_post_update_mtype_mname_mvalue_requests_total")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, "1", string(resp.Body()))
+
+	resp, err = resty.New().R().
+		SetHeader("Accept-Encoding", "").
+		Get(srv.URL + "/metrics")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Contains(t, string(resp.Body()), "# TYPE c1 counter\nc1 5\n")
+	assert.Contains(t, string(resp.Body()), "server_storage_save_total 1\n")
+
+	resp, err = resty.New().R().Post(srv.URL + updateBasePath + "/counter/server_xyz/5")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "reserved IDs are rejected")
+	resp, err = resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`[{"id":"server_xyz","type":"counter","delta":5}]`).
+		Post(srv.URL + "/updates/")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode(), "reserved IDs are rejected")
+}
+
+func TestPrometheusLabels(t *testing.T) {
+	storage := storage2.NewMemStorage()
+	ctx := context.Background()
+	for _, id := range []string{
+		models.WithLabels("DiskFree", map[string]string{"mountpoint": "/"}),
+		models.WithLabels("DiskFree", map[string]string{"mountpoint": "/data \"x\"\n"}),
+		"DiskFree_mountpoint____",
+	} {
+		v := 1.0
+		_ = storage.Save(ctx, &models.Metric{ID: id, MType: models.GaugeMetricName, Value: &v})
+	}
+	srv := httptest.NewServer(BuildRouter(storage, nil, ""))
+	defer srv.Close()
+
+	resp, err := resty.New().R().SetHeader("Accept-Encoding", "").Get(srv.URL + "/metrics")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, "# TYPE DiskFree gauge\n"+
+		"DiskFree{mountpoint=\"/\"} 1\n"+
+		"DiskFree{mountpoint=\"/data \\\"x\\\"\\n\"} 1\n"+
+		"# TYPE DiskFree_mountpoint____ gauge\n"+
+		"DiskFree_mountpoint____ 1\n", string(resp.Body()), "label sets are exposed as labels and do not collide")
+}
+
+func TestPrometheusConflicts(t *testing.T) {
+	storage := storage2.NewMemStorage()
+	ctx := context.Background()
+	v, d := 1.0, int64(2)
+	_ = storage.Save(ctx, &models.Metric{ID: "requests", MType: models.GaugeMetricName, Value: &v})
+	_ = storage.Save(ctx, &models.Metric{ID: "requests", MType: models.CounterMetricName, Delta: &d})
+	_ = storage.Save(ctx, &models.Metric{ID: "cpu.usage", MType: models.GaugeMetricName, Value: &v})
+	_ = storage.Save(ctx, &models.Metric{ID: "cpu-usage", MType: models.GaugeMetricName, Value: &v})
+	srv := httptest.NewServer(BuildRouter(storage, nil, ""))
+	defer srv.Close()
+
+	resp, err := resty.New().R().SetHeader("Accept-Encoding", "").Get(srv.URL + "/metrics")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, "# TYPE cpu_usage gauge\n"+
+		"cpu_usage 1\n"+
+		"# TYPE requests gauge\n"+
+		"requests 1\n", string(resp.Body()), "every family has one TYPE line and one series per label set")
+}
+
+func TestRouteMetricName(t *testing.T) {
+	assert.Equal(t, "post_update_mtype_mname_mvalue", routeMetricName(http.MethodPost, "/update/{mType}/{mName}/{mValue}"))
+	assert.Equal(t, "post_updates", routeMetricName(http.MethodPost, "/updates/"))
+	assert.Equal(t, "get_root", routeMetricName(http.MethodGet, "/"))
+	assert.Equal(t, "get_unmatched", routeMetricName(http.MethodGet, ""))
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	registry := health.NewRegistry()
+	var startup health.Startup
+	registry.Register("startup", health.Readiness, startup.Check)
+
+	srv := httptest.NewServer(BuildRouter(storage2.NewMemStorage(), nil, "", WithHealth(registry)))
+	defer srv.Close()
+
+	resp, err := resty.New().R().Get(srv.URL + "/healthz")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	var report health.Report
+	resp, err = resty.New().R().SetResult(&report).Get(srv.URL + "/readyz")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode())
+
+	startup.MarkReady()
+	resp, err = resty.New().R().SetResult(&report).Get(srv.URL + "/readyz")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+	assert.Equal(t, health.StatusOK, report.Status)
+	assert.Equal(t, "startup", report.Checks[0].Name)
+
+	resp, err = resty.New().R().Get(srv.URL + "/ping")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode())
+}
@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/logger"
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/DenisPavlov/monitoring/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+var _ http.ResponseWriter = (*statusWriter)(nil)
+
+// statusWriter wraps http.ResponseWriter to capture the response status code.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader captures the status code and delegates to the underlying ResponseWriter.
+func (w *statusWriter) WriteHeader(statusCode int) {
+	w.status = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// HTTPMetricsMiddleware provides HTTP middleware that records request counts and
+// latencies per route as self-metrics.
+//
+// The route is taken from the chi route pattern after the request has been served,
+// so all requests matching "/update/{mType}/{mName}/{mValue}" share the same metrics.
+// Requests that did not match any route are recorded under the "unmatched" route.
+//
+// Recorded metrics for every route:
+//   - server_http_<route>_requests_total: number of requests (counter)
+//   - server_http_<route>_errors_total: number of responses with status >= 500 (counter)
+//   - server_http_<route>_duration_us_total: accumulated handling time in microseconds (counter)
+//   - server_http_<route>_duration_seconds: handling time of the last request (gauge)
+//
+// Parameters:
+//   - self: Storage where self-metrics are recorded
+//
+// Returns:
+//   - func(http.Handler) http.Handler: Chi middleware function
+func HTTPMetricsMiddleware(self storage.MetricsStorage) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			elapsed := time.Since(start)
+
+			pattern := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				pattern = rctx.RoutePattern()
+			}
+			prefix := storage.SelfMetricsPrefix + "http_" + routeMetricName(r.Method, pattern)
+
+			var failed int64
+			if sw.status >= http.StatusInternalServerError {
+				failed = 1
+			}
+			requests := int64(1)
+			durationUs := elapsed.Microseconds()
+			durationSec := elapsed.Seconds()
+			batch := []models.Metric{
+				{ID: prefix + "_requests_total", MType: models.CounterMetricName, Delta: &requests},
+				{ID: prefix + "_errors_total", MType: models.CounterMetricName, Delta: &failed},
+				{ID: prefix + "_duration_us_total", MType: models.CounterMetricName, Delta: &durationUs},
+				{ID: prefix + "_duration_seconds", MType: models.GaugeMetricName, Value: &durationSec},
+			}
+			if err := self.SaveAll(context.Background(), batch); err != nil {
+				logger.Log.Errorf("cannot record HTTP self-metrics: %v", err)
+			}
+		})
+	}
+}
+
+// routeMetricName converts an HTTP method and a chi route pattern into a metric name part.
+//
+// Example output:
+//   - "POST", "/update/{mType}/{mName}/{mValue}" -> "post_update_mtype_mname_mvalue"
+//   - "GET", "/" -> "get_root"
+//   - "GET", "" -> "get_unmatched"
+func routeMetricName(method, pattern string) string {
+	var sb strings.Builder
+	sb.WriteString(strings.ToLower(method))
+	switch pattern {
+	case "":
+		return sb.String() + "_unmatched"
+	case "/":
+		return sb.String() + "_root"
+	}
+
+	underscore := false
+	for _, ch := range strings.ToLower(pattern) {
+		if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') {
+			if underscore {
+				sb.WriteByte('_')
+				underscore = false
+			}
+			sb.WriteRune(ch)
+		} else {
+			underscore = true
+		}
+	}
+	return sb.String()
+}
+
+// prometheusMetricsHandler returns a handler exposing all metrics in the
+// Prometheus text exposition format.
+//
+// Gauges are exposed with TYPE gauge and counters with TYPE counter. Labels of metric
+// IDs built by models.WithLabels are exposed as Prometheus labels, so all series of
+// a name share a single TYPE line. Names and label names are sanitized to valid
+// Prometheus names. Series conflicting with an exposed one, i.e. a counter named like
+// a gauge or an ID sanitized to the name and labels of another, are left out and logged.
+//
+// Returns:
+//   - HTTP 500 for storage errors
+//   - HTTP 200 with metrics in text/plain; version=0.0.4 format
+func prometheusMetricsHandler(storage storage.MetricsStorage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type series struct {
+			name, labels string
+			metric       models.Metric
+		}
+		var all []series
+		for _, mType := range []string{models.GaugeMetricName, models.CounterMetricName} {
+			metrics, err := storage.GetAllByType(r.Context(), mType)
+			if err != nil {
+				logger.Log.Errorf("Can not get all %s metrics: %s", mType, err.Error())
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			for _, m := range metrics {
+				name, labels := models.SplitLabels(m.ID)
+				all = append(all, series{name: prometheusName(name), labels: prometheusLabels(labels), metric: m})
+			}
+		}
+		// Gauges sort before counters of the same name, so the gauge wins a conflict.
+		sort.SliceStable(all, func(i, j int) bool {
+			if all[i].name != all[j].name {
+				return all[i].name < all[j].name
+			}
+			if all[i].metric.MType != all[j].metric.MType {
+				return all[i].metric.MType == models.GaugeMetricName
+			}
+			return all[i].labels < all[j].labels
+		})
+
+		var sb strings.Builder
+		var family string
+		for i, s := range all {
+			m := s.metric
+			if i == 0 || all[i-1].name != s.name {
+				family = m.MType
+				fmt.Fprintf(&sb, "# TYPE %s %s\n", s.name, family)
+			} else if m.MType != family || all[i-1].labels == s.labels {
+				logger.Log.Warnf("Metric %s %s conflicts with another series of %s, not exposed", m.MType, m.ID, s.name)
+				continue
+			}
+			switch {
+			case m.MType == models.GaugeMetricName && m.Value != nil:
+				fmt.Fprintf(&sb, "%s%s %s\n", s.name, s.labels, strconv.FormatFloat(*m.Value, 'g', -1, 64))
+			case m.MType == models.CounterMetricName && m.Delta != nil:
+				fmt.Fprintf(&sb, "%s%s %d\n", s.name, s.labels, *m.Delta)
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write([]byte(sb.String()))
+	}
+}
+
+// prometheusLabels formats labels as a Prometheus label set with keys sorted
+// alphabetically. Backslashes, quotes and line feeds in values are escaped.
+// Without labels an empty string is returned.
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strings.ReplaceAll(prometheusName(k), ":", "_"))
+		sb.WriteString(`="`)
+		sb.WriteString(labelValueReplacer.Replace(labels[k]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// labelValueReplacer escapes label values of the Prometheus text format.
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// prometheusName replaces characters that are not allowed in Prometheus
+// metric names with underscores.
+func prometheusName(id string) string {
+	var sb strings.Builder
+	for i, ch := range id {
+		valid := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || ch == '_' || ch == ':' ||
+			(i > 0 && ch >= '0' && ch <= '9')
+		if valid {
+			sb.WriteRune(ch)
+		} else {
+			sb.WriteByte('_')
+		}
+	}
+	return sb.String()
+}
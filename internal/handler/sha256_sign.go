@@ -2,9 +2,15 @@ package handler
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/DenisPavlov/monitoring/internal/logger"
 	"github.com/DenisPavlov/monitoring/internal/util"
 )
 
@@ -12,32 +18,74 @@ import (
 // Both requests and responses use this header for signature transmission.
 const SHA256HeaderName = "HashSHA256"
 
-// respWriter is a wrapper around http.ResponseWriter that automatically
-// signs response bodies with SHA256 hash when a cryptographic key is provided.
+// Headers of the request signing scheme version 2 (see util.GetHexSHA256Request).
+// Requests signed with version 1 have none of them and sign the body only.
+const (
+	// SignatureVersionHeaderName holds the signing scheme version, SignatureVersion.
+	SignatureVersionHeaderName = "X-Signature-Version"
+	// SignatureTimestampHeaderName holds the unix time of signing in seconds.
+	SignatureTimestampHeaderName = "X-Signature-Timestamp"
+	// SignatureNonceHeaderName holds a random value unique for every request.
+	SignatureNonceHeaderName = "X-Signature-Nonce"
+)
+
+// SignatureVersion is the current request signing scheme version.
+const SignatureVersion = "2"
+
+const (
+	// signatureWindow is the maximum difference between the timestamp of a signed
+	// request and the server time. Nonces are remembered for the same time.
+	signatureWindow = 5 * time.Minute
+	// maxNonceLength limits the nonces kept in memory.
+	maxNonceLength = 128
+)
+
+// Errors of request signature verification, returned in the body of the 400 response.
+var (
+	errSignatureMismatch = errors.New("signature mismatch")
+	errMissingSignature  = errors.New("signature required, set the " + SHA256HeaderName + " header")
+	errLegacySignature   = errors.New("signatures of version 1 are not accepted, use version " + SignatureVersion)
+	errStaleSignature    = errors.New("signature timestamp outside the allowed window")
+	errReplayedSignature = errors.New("signature nonce already used")
+)
+
+// respWriter is a wrapper around http.ResponseWriter that signs the response body
+// with HMAC-SHA256 of the key.
 //
-// It implements the http.ResponseWriter interface and transparently
-// adds the SHA256 signature header to responses.
+// The signature must be sent in a header, before the body, so respWriter buffers
+// the status and the whole body and sends them with the signature in flush.
 type respWriter struct {
 	http.ResponseWriter
-	key string
+	key    string
+	status int
+	body   bytes.Buffer
 }
 
-// Write writes the data to the underlying ResponseWriter and adds a SHA256
-// signature header calculated from the response body and the provided key.
-//
-// The signature is calculated as SHA256(key + body) and set in the
-// SHA256HeaderName header.
-//
-// Parameters:
-//   - b: response body bytes to write and sign
-//
-// Returns:
-//   - int: number of bytes written
-//   - error: any write error that occurred
+// WriteHeader records the status code sent by flush.
+func (w *respWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+// Write appends b to the buffered response body.
 func (w *respWriter) Write(b []byte) (int, error) {
-	respSign := util.GetHexSHA256(w.key, b)
-	w.Header().Set(SHA256HeaderName, respSign)
-	return w.ResponseWriter.Write(b)
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+// flush sets the signature of the buffered body in the SHA256HeaderName header
+// and sends the response.
+func (w *respWriter) flush() error {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.Header().Set(SHA256HeaderName, util.GetHexSHA256(w.key, w.body.Bytes()))
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.body.Bytes())
+	return err
 }
 
 // SHA256SignMiddleware provides middleware for SHA256 request signature verification
@@ -45,16 +93,17 @@ func (w *respWriter) Write(b []byte) (int, error) {
 //
 // The middleware performs two functions:
 //  1. Request Verification: For incoming requests with SHA256HeaderName header,
-//     it verifies that the request body matches the provided signature.
+//     it verifies the signature of the request (see SHA256VerifyMiddleware).
 //     Returns HTTP 400 if verification fails.
-//  2. Response Signing: For outgoing responses, it automatically signs the
-//     response body with SHA256 when a key is provided.
+//  2. Response Signing: Every response, including error responses, is signed
+//     with the key in the SHA256HeaderName header.
 //
-// Signature format: SHA256(key + body)
+// Response signature format: HMAC-SHA256(key, body)
 //
 // Parameters:
 //   - key: Cryptographic key used for both verification and signing.
 //     If empty, the middleware will skip signature processing.
+//   - opts: Options of request verification, e.g. AcceptLegacySignatures
 //
 // Returns:
 //   - func(http.Handler) http.Handler: Chi middleware function
@@ -64,35 +113,182 @@ func (w *respWriter) Write(b []byte) (int, error) {
 //	router := chi.NewRouter()
 //	router.Use(SHA256SignMiddleware("your-secret-key"))
 //
-// The middleware handles both scenarios:
-//   - Requests with HashSHA256 header: verifies the signature
-//   - Requests without HashSHA256 header: signs the response
+// The response signature covers the body exactly as written by the next handler.
+// If responses are compressed, use SHA256ResponseSignMiddleware before GzipMiddleware
+// and SHA256VerifyMiddleware after it instead, so the compressed body is signed and
+// the decompressed request body is verified.
 //
 // Security Note: The key should be kept secret and shared between client and server.
-func SHA256SignMiddleware(key string) func(next http.Handler) http.Handler {
+func SHA256SignMiddleware(key string, opts ...VerifyOption) func(next http.Handler) http.Handler {
+	return SHA256SignMiddlewareFunc(func() string { return key }, opts...)
+}
+
+// SHA256SignMiddlewareFunc works like SHA256SignMiddleware but obtains the key
+// from the provider on every request, which allows changing the key at runtime.
+// Requests are passed through unchanged while the provider returns an empty key.
+//
+// Usage:
+//
+//	router.Use(SHA256SignMiddlewareFunc(func() string { return config.Current().Key }))
+func SHA256SignMiddlewareFunc(keyProvider func() string, opts ...VerifyOption) func(next http.Handler) http.Handler {
+	sign := SHA256ResponseSignMiddlewareFunc(keyProvider)
+	verify := SHA256VerifyMiddlewareFunc(keyProvider, opts...)
+	return func(next http.Handler) http.Handler {
+		return sign(verify(next))
+	}
+}
+
+// VerifyOption configures request signature verification.
+type VerifyOption func(*verifier)
+
+// AcceptLegacySignatures enables or disables requests signed with version 1, which
+// covers the body only and can be replayed. Default: disabled. Enable it only while
+// clients are migrated to version 2.
+func AcceptLegacySignatures(enabled bool) VerifyOption {
+	return func(v *verifier) {
+		v.legacy = enabled
+	}
+}
+
+// verifier checks request signatures and remembers the nonces of accepted requests.
+type verifier struct {
+	legacy bool
+	nonces *nonceCache
+	now    func() time.Time
+}
+
+// SHA256VerifyMiddleware verifies the signature of requests with the SHA256HeaderName
+// header and responds with HTTP 400 if it is invalid. Requests without the header are
+// passed through; use RequireSignatureMiddlewareFunc to reject them.
+//
+// Requests must be signed with version 2 of the signing scheme: the signature covers
+// the method, the path with the query, the SignatureTimestampHeaderName and
+// SignatureNonceHeaderName headers and the body. A request is rejected if its timestamp
+// differs from the server time by more than 5 minutes or its nonce was already used
+// within that window. Version 1 signatures of the body only are rejected unless
+// AcceptLegacySignatures is given.
+func SHA256VerifyMiddleware(key string, opts ...VerifyOption) func(next http.Handler) http.Handler {
+	return SHA256VerifyMiddlewareFunc(func() string { return key }, opts...)
+}
+
+// SHA256VerifyMiddlewareFunc works like SHA256VerifyMiddleware but obtains the key
+// from the provider on every request. Requests are passed through unchanged while
+// the provider returns an empty key.
+func SHA256VerifyMiddlewareFunc(keyProvider func() string, opts ...VerifyOption) func(next http.Handler) http.Handler {
+	v := &verifier{nonces: newNonceCache(), now: time.Now}
+	for _, opt := range opts {
+		opt(v)
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyProvider()
 			hashValue := r.Header.Get(SHA256HeaderName)
+			if key == "" || hashValue == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			if hashValue != "" {
-				body, err := io.ReadAll(r.Body)
-				if err != nil {
-					w.WriteHeader(http.StatusBadRequest)
-					return
-				}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err := v.verify(key, hashValue, r, body); err != nil {
+				logger.Log.Infof("Rejected signed request %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-				sign := util.GetHexSHA256(key, body)
+// RequireSignatureMiddlewareFunc rejects requests without the SHA256HeaderName header
+// with HTTP 400 while the provider returns a non-empty key, and passes all requests
+// through otherwise.
+//
+// SHA256VerifyMiddlewareFunc passes unsigned requests through, so the signature of a
+// captured request could be stripped to replay it. Use this middleware on mutating
+// endpoints after SHA256VerifyMiddlewareFunc, which verifies the present signatures.
+func RequireSignatureMiddlewareFunc(keyProvider func() string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if keyProvider() != "" && r.Header.Get(SHA256HeaderName) == "" {
+				logger.Log.Infof("Rejected unsigned request %s %s", r.Method, r.URL.Path)
+				http.Error(w, errMissingSignature.Error(), http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verify checks the signature of a request with the given body.
+func (v *verifier) verify(key, sign string, r *http.Request, body []byte) error {
+	switch version := r.Header.Get(SignatureVersionHeaderName); version {
+	case "":
+		if !v.legacy {
+			return errLegacySignature
+		}
+		return compareSignatures(sign, util.GetHexSHA256(key, body))
+	case SignatureVersion:
+		timestamp := r.Header.Get(SignatureTimestampHeaderName)
+		nonce := r.Header.Get(SignatureNonceHeaderName)
+		if nonce == "" || len(nonce) > maxNonceLength {
+			return fmt.Errorf("invalid %s header", SignatureNonceHeaderName)
+		}
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s header", SignatureTimestampHeaderName)
+		}
+		signed, now := time.Unix(seconds, 0), v.now()
+		if signed.Before(now.Add(-signatureWindow)) || signed.After(now.Add(signatureWindow)) {
+			return errStaleSignature
+		}
+		want := util.GetHexSHA256Request(key, r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+		if err := compareSignatures(sign, want); err != nil {
+			return err
+		}
+		// Nonces are recorded only for valid signatures, so forged requests cannot fill the cache.
+		if !v.nonces.add(nonce, signed.Add(signatureWindow), now) {
+			return errReplayedSignature
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown signature version %q", version)
+	}
+}
 
-				if sign != hashValue {
-					w.WriteHeader(http.StatusBadRequest)
-					return
-				}
-				r.Body = io.NopCloser(bytes.NewBuffer(body))
+// compareSignatures compares hex signatures in constant time.
+func compareSignatures(got, want string) error {
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return errSignatureMismatch
+	}
+	return nil
+}
+
+// SHA256ResponseSignMiddleware signs the body of every response in the
+// SHA256HeaderName header. Place it before GzipMiddleware to sign the body as sent,
+// i.e. after compression.
+func SHA256ResponseSignMiddleware(key string) func(next http.Handler) http.Handler {
+	return SHA256ResponseSignMiddlewareFunc(func() string { return key })
+}
+
+// SHA256ResponseSignMiddlewareFunc works like SHA256ResponseSignMiddleware but
+// obtains the key from the provider on every request. Responses are not signed
+// while the provider returns an empty key.
+func SHA256ResponseSignMiddlewareFunc(keyProvider func() string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := keyProvider()
+			if key == "" {
 				next.ServeHTTP(w, r)
-			} else {
-				rw := &respWriter{ResponseWriter: w}
-				next.ServeHTTP(rw, r)
+				return
 			}
+			rw := &respWriter{ResponseWriter: w, key: key}
+			next.ServeHTTP(rw, r)
+			_ = rw.flush()
 		})
 	}
 }
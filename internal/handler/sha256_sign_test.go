@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	storage2 "github.com/DenisPavlov/monitoring/internal/storage"
+	"github.com/DenisPavlov/monitoring/internal/util"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSHA256Sign(t *testing.T) {
+	const key = "secret"
+	srv := httptest.NewServer(BuildRouter(storage2.NewMemStorage(), nil, key, WithLegacySignatures(true)))
+	defer srv.Close()
+	// The transport must not decompress responses, so the signature is checked over the wire body.
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	metric := `{"id":"c1","type":"counter","delta":3}`
+	tests := []struct {
+		name       string
+		body       string
+		sign       string
+		gzip       bool
+		wantStatus int
+	}{
+		{name: "signed request", body: metric, sign: util.GetHexSHA256(key, []byte(metric)), wantStatus: http.StatusOK},
+		{name: "gzip response", body: metric, sign: util.GetHexSHA256(key, []byte(metric)), gzip: true, wantStatus: http.StatusOK},
+		{name: "unsigned request", body: metric, wantStatus: http.StatusOK},
+		{name: "wrong signature", body: metric, sign: util.GetHexSHA256("other", []byte(metric)), wantStatus: http.StatusBadRequest},
+		{name: "invalid metric", body: `{"id":"c1"}`, gzip: true, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/update/", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.sign != "" {
+				req.Header.Set(SHA256HeaderName, tt.sign)
+			}
+			if tt.gzip {
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, util.GetHexSHA256(key, body), resp.Header.Get(SHA256HeaderName))
+			if tt.gzip && tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+				zr, err := gzip.NewReader(bytes.NewReader(body))
+				require.NoError(t, err)
+				plain, err := io.ReadAll(zr)
+				require.NoError(t, err)
+				assert.JSONEq(t, `{"id":"c1","type":"counter","delta":6}`, string(plain))
+			}
+		})
+	}
+}
+
+func TestSHA256SignMiddleware(t *testing.T) {
+	handler := SHA256SignMiddleware("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello, "))
+		_, _ = w.Write([]byte("world"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "hello, world", w.Body.String())
+	assert.Equal(t, util.GetHexSHA256("secret", []byte("hello, world")), w.Header().Get(SHA256HeaderName))
+}
+
+func TestSHA256VerifyMiddleware(t *testing.T) {
+	const key = "secret"
+	handler := SHA256VerifyMiddleware(key)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	legacyHandler := SHA256VerifyMiddleware(key, AcceptLegacySignatures(true))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	body := `[{"id":"c1","type":"counter","delta":3}]`
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signed := func(path, timestamp, nonce string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set(SignatureVersionHeaderName, SignatureVersion)
+		r.Header.Set(SignatureTimestampHeaderName, timestamp)
+		r.Header.Set(SignatureNonceHeaderName, nonce)
+		r.Header.Set(SHA256HeaderName, util.GetHexSHA256Request(key, http.MethodPost, "/updates/", timestamp, nonce, []byte(body)))
+		return r
+	}
+	legacy := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/updates/", strings.NewReader(body))
+		r.Header.Set(SHA256HeaderName, util.GetHexSHA256(key, []byte(body)))
+		return r
+	}
+	serve := func(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve(handler, signed("/updates/", now, "n1")).Code)
+	replayed := serve(handler, signed("/updates/", now, "n1"))
+	assert.Equal(t, http.StatusBadRequest, replayed.Code)
+	assert.Contains(t, replayed.Body.String(), errReplayedSignature.Error())
+	assert.Equal(t, http.StatusOK, serve(legacyHandler, signed("/updates/", now, "n1")).Code, "nonces are kept per middleware")
+
+	stale := strconv.FormatInt(time.Now().Add(-2*signatureWindow).Unix(), 10)
+	resp := serve(handler, signed("/updates/", stale, "n2"))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), errStaleSignature.Error())
+
+	resp = serve(handler, signed("/update/", now, "n3"))
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "the signature covers the path")
+	assert.Contains(t, resp.Body.String(), errSignatureMismatch.Error())
+	assert.Equal(t, http.StatusOK, serve(handler, signed("/updates/", now, "n3")).Code,
+		"the nonce of a rejected request is not recorded")
+
+	resp = serve(handler, signed("/updates/", "yesterday", "n4"))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, http.StatusBadRequest, serve(handler, signed("/updates/", now, "")).Code)
+
+	resp = serve(handler, legacy())
+	assert.Equal(t, http.StatusBadRequest, resp.Code, "version 1 is rejected by default")
+	assert.Contains(t, resp.Body.String(), errLegacySignature.Error())
+	assert.Equal(t, http.StatusOK, serve(legacyHandler, legacy()).Code)
+	assert.Equal(t, http.StatusOK, serve(legacyHandler, legacy()).Code, "version 1 signatures can be replayed")
+}
+
+func TestNonceCache(t *testing.T) {
+	c := newNonceCache()
+	now := time.Now()
+	assert.True(t, c.add("n", now.Add(time.Minute), now))
+	assert.False(t, c.add("n", now.Add(time.Minute), now.Add(30*time.Second)))
+	assert.True(t, c.add("n", now.Add(3*time.Minute), now.Add(time.Minute)), "an expired nonce may be used again")
+
+	c.add("old", now.Add(time.Minute), now)
+	c.prune(now.Add(5 * time.Minute))
+	assert.Empty(t, c.expires)
+}
+
+func TestSHA256Verify_StrippedSignature(t *testing.T) {
+	const key = "secret"
+	storage := storage2.NewMemStorage()
+	srv := httptest.NewServer(BuildRouter(storage, nil, key))
+	defer srv.Close()
+
+	body := `[{"id":"c1","type":"counter","delta":3}]`
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	captured, err := http.NewRequest(http.MethodPost, srv.URL+"/updates/", strings.NewReader(body))
+	require.NoError(t, err)
+	captured.Header.Set("Content-Type", "application/json")
+	captured.Header.Set(SignatureVersionHeaderName, SignatureVersion)
+	captured.Header.Set(SignatureTimestampHeaderName, timestamp)
+	captured.Header.Set(SignatureNonceHeaderName, "n1")
+	captured.Header.Set(SHA256HeaderName, util.GetHexSHA256Request(key, http.MethodPost, "/updates/", timestamp, "n1", []byte(body)))
+	resp, err := http.DefaultClient.Do(captured)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	for _, path := range []string{"/updates/", "/update/counter/c1/3"} {
+		replayed, err := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		replayed.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(replayed)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "%s: a replay without signature headers is rejected", path)
+	}
+
+	saved, err := storage.GetByTypeAndID(context.Background(), "c1", models.CounterMetricName)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *saved.Delta)
+
+	resp, err = http.Get(srv.URL + "/value/")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "reads do not require a signature")
+}
+
+func TestSHA256Verify_UnsignedLegacy(t *testing.T) {
+	srv := httptest.NewServer(BuildRouter(storage2.NewMemStorage(), nil, "secret", WithLegacySignatures(true)))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/updates/", strings.NewReader(`[{"id":"c1","type":"counter","delta":3}]`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "unsigned updates are accepted in legacy mode")
+}
@@ -0,0 +1,171 @@
+// Package health provides a pluggable registry of liveness and readiness checks
+// used by the server health endpoints.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status values reported for individual checks and for the whole report.
+const (
+	// StatusOK means that the check passed.
+	StatusOK = "ok"
+
+	// StatusFailed means that the check returned an error or panicked.
+	StatusFailed = "failed"
+)
+
+// defaultTimeout limits the duration of a single check.
+const defaultTimeout = time.Second
+
+// Kind defines which endpoint a check belongs to.
+type Kind int
+
+const (
+	// Liveness checks tell whether the process is alive and should not be restarted.
+	Liveness Kind = iota
+
+	// Readiness checks tell whether the process is ready to serve requests.
+	Readiness
+)
+
+// Check is a single health check. It returns nil if the checked component is healthy.
+type Check func(ctx context.Context) error
+
+// Result describes the outcome of a single check.
+type Result struct {
+	// Name is the name the check was registered with.
+	Name string `json:"name"`
+
+	// Status is either StatusOK or StatusFailed.
+	Status string `json:"status"`
+
+	// Error is the check error message. Only present when Status is StatusFailed.
+	Error string `json:"error,omitempty"`
+
+	// Duration is the time the check took, formatted as a Go duration.
+	Duration string `json:"duration"`
+}
+
+// Report is the outcome of running all checks of one kind.
+type Report struct {
+	// Status is StatusOK if all checks passed, StatusFailed otherwise.
+	Status string `json:"status"`
+
+	// Checks lists the results of the individual checks in registration order.
+	Checks []Result `json:"checks"`
+}
+
+// Healthy reports whether all checks in the report passed.
+func (r Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+type entry struct {
+	name  string
+	kind  Kind
+	check Check
+}
+
+// Registry holds registered health checks. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	entries []entry
+	timeout time.Duration
+}
+
+// NewRegistry creates an empty check registry.
+//
+// Example usage:
+//
+//	registry := health.NewRegistry()
+//	registry.Register("postgres", health.Readiness, store.Ping)
+func NewRegistry() *Registry {
+	return &Registry{timeout: defaultTimeout}
+}
+
+// Register adds a named check of the given kind to the registry.
+func (r *Registry) Register(name string, kind Kind, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entry{name: name, kind: kind, check: check})
+}
+
+// Run executes all checks of the given kind and returns the combined report.
+//
+// Every check runs with its own timeout. A panicking check is reported as failed.
+// A report without any checks is healthy.
+func (r *Registry) Run(ctx context.Context, kind Kind) Report {
+	r.mu.RLock()
+	entries := make([]entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		if e.kind == kind {
+			entries = append(entries, e)
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, 0, len(entries))}
+	for _, e := range entries {
+		start := time.Now()
+		err := r.runOne(ctx, e.check)
+		res := Result{Name: e.name, Status: StatusOK, Duration: time.Since(start).String()}
+		if err != nil {
+			res.Status = StatusFailed
+			res.Error = err.Error()
+			report.Status = StatusFailed
+		}
+		report.Checks = append(report.Checks, res)
+	}
+	return report
+}
+
+func (r *Registry) runOne(ctx context.Context, check Check) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("check panicked: %v", rec)
+		}
+	}()
+	return check(ctx)
+}
+
+// Startup is a readiness check that fails until MarkReady is called.
+// It is used to report readiness only after the server finished initialization,
+// e.g. restored its storage from a file.
+type Startup struct {
+	ready atomic.Bool
+}
+
+// MarkReady marks the startup as completed.
+func (s *Startup) MarkReady() {
+	s.ready.Store(true)
+}
+
+// Check returns an error until MarkReady has been called.
+func (s *Startup) Check(_ context.Context) error {
+	if !s.ready.Load() {
+		return fmt.Errorf("startup is not completed")
+	}
+	return nil
+}
+
+// MaxAge returns a check that fails if the time returned by since is older than maxAge.
+//
+// Example usage:
+//
+//	registry.Register("file_snapshot_age", health.Readiness, health.MaxAge(store.LastSavedAt, 10*time.Minute))
+func MaxAge(since func() time.Time, maxAge time.Duration) Check {
+	return func(_ context.Context) error {
+		if age := time.Since(since()); age > maxAge {
+			return fmt.Errorf("age %s exceeds %s", age.Truncate(time.Second), maxAge)
+		}
+		return nil
+	}
+}
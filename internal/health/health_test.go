@@ -0,0 +1,45 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Run(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("ok", Readiness, func(context.Context) error { return nil })
+	registry.Register("failing", Readiness, func(context.Context) error { return errors.New("boom") })
+	registry.Register("panicking", Readiness, func(context.Context) error { panic("oops") })
+	registry.Register("live", Liveness, func(context.Context) error { return nil })
+
+	report := registry.Run(context.Background(), Readiness)
+	assert.False(t, report.Healthy())
+	assert.Len(t, report.Checks, 3)
+	assert.Equal(t, StatusOK, report.Checks[0].Status)
+	assert.Equal(t, "boom", report.Checks[1].Error)
+	assert.Equal(t, StatusFailed, report.Checks[2].Status)
+	assert.Contains(t, report.Checks[2].Error, "oops")
+
+	report = registry.Run(context.Background(), Liveness)
+	assert.True(t, report.Healthy())
+	assert.Len(t, report.Checks, 1)
+}
+
+func TestStartup(t *testing.T) {
+	var startup Startup
+	assert.Error(t, startup.Check(context.Background()))
+	startup.MarkReady()
+	assert.NoError(t, startup.Check(context.Background()))
+}
+
+func TestMaxAge(t *testing.T) {
+	fresh := MaxAge(time.Now, time.Minute)
+	assert.NoError(t, fresh(context.Background()))
+
+	stale := MaxAge(func() time.Time { return time.Now().Add(-time.Hour) }, time.Minute)
+	assert.Error(t, stale(context.Background()))
+}
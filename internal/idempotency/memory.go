@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// entry is a key kept by MemoryStore.
+type entry struct {
+	fingerprint string
+	// result is nil while the request is being applied.
+	result  *Result
+	created time.Time
+}
+
+// MemoryStore is a Store keeping keys in memory. Keys are forgotten on restart.
+type MemoryStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastPrune time.Time
+}
+
+// NewMemoryStore creates a store remembering results for ttl.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin implements Store.
+func (s *MemoryStore) Begin(_ context.Context, key, fingerprint string) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+	if e, ok := s.entries[key]; ok && !s.expired(e, now) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case e.result == nil:
+			return nil, ErrInProgress
+		default:
+			return e.result, nil
+		}
+	}
+	s.entries[key] = &entry{fingerprint: fingerprint, created: now}
+	return nil, nil
+}
+
+// Complete implements Store.
+func (s *MemoryStore) Complete(_ context.Context, key string, res Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.result = &res
+		e.created = s.now()
+	}
+	return nil
+}
+
+// Release implements Store.
+func (s *MemoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// expired reports whether a completed key is older than the TTL or a reservation
+// was abandoned.
+func (s *MemoryStore) expired(e *entry, now time.Time) bool {
+	if e.result == nil {
+		return now.Sub(e.created) > lockTimeout
+	}
+	return now.Sub(e.created) > s.ttl
+}
+
+// prune removes expired keys, at most once per minute.
+func (s *MemoryStore) prune(now time.Time) {
+	if now.Sub(s.lastPrune) < time.Minute {
+		return
+	}
+	s.lastPrune = now
+	for key, e := range s.entries {
+		if s.expired(e, now) {
+			delete(s.entries, key)
+		}
+	}
+}
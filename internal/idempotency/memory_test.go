@@ -0,0 +1,58 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(time.Hour)
+
+	res, err := s.Begin(ctx, "k1", "f1")
+	assert.NoError(t, err)
+	assert.Nil(t, res, "a new key is reserved")
+
+	_, err = s.Begin(ctx, "k1", "f1")
+	assert.ErrorIs(t, err, ErrInProgress)
+	_, err = s.Begin(ctx, "k1", "f2")
+	assert.ErrorIs(t, err, ErrMismatch)
+
+	assert.NoError(t, s.Complete(ctx, "k1", Result{Status: 200, Body: []byte("ok")}))
+	res, err = s.Begin(ctx, "k1", "f1")
+	assert.NoError(t, err)
+	assert.Equal(t, &Result{Status: 200, Body: []byte("ok")}, res)
+
+	_, _ = s.Begin(ctx, "k2", "f1")
+	assert.NoError(t, s.Release(ctx, "k2"))
+	res, err = s.Begin(ctx, "k2", "f1")
+	assert.NoError(t, err)
+	assert.Nil(t, res, "a released key is reserved again")
+}
+
+func TestMemoryStore_Expiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := NewMemoryStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	_, _ = s.Begin(ctx, "abandoned", "f")
+	_, _ = s.Begin(ctx, "done", "f")
+	assert.NoError(t, s.Complete(ctx, "done", Result{Status: 200}))
+
+	now = now.Add(2 * lockTimeout)
+	res, err := s.Begin(ctx, "abandoned", "f")
+	assert.NoError(t, err)
+	assert.Nil(t, res, "an abandoned reservation is taken over")
+	res, _ = s.Begin(ctx, "done", "f")
+	assert.NotNil(t, res)
+
+	now = now.Add(2 * time.Hour)
+	res, err = s.Begin(ctx, "done", "f")
+	assert.NoError(t, err)
+	assert.Nil(t, res, "an expired key is reserved again")
+	assert.NotContains(t, s.entries, "abandoned", "expired keys are pruned")
+}
@@ -0,0 +1,123 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// PostgresStore is a Store keeping keys in the idempotency_keys table, so results
+// survive restarts and are shared by all servers using the database.
+type PostgresStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+// NewPostgresStore creates a store remembering results for ttl.
+// InitSchema must be called before use.
+func NewPostgresStore(db *sql.DB, ttl time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, ttl: ttl}
+}
+
+// InitSchema creates the idempotency_keys table if it doesn't already exist.
+//
+// The created table structure:
+//   - key: TEXT PRIMARY KEY (idempotency key prefixed with the request path)
+//   - fingerprint: TEXT (hash of the request)
+//   - status: INTEGER (response status code, NULL while the request is being applied)
+//   - content_type: TEXT (response content type)
+//   - body: BYTEA (response body)
+//   - created_at: TIMESTAMPTZ (time of the reservation or completion)
+func (s *PostgresStore) InitSchema(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+		    key TEXT PRIMARY KEY,
+		    fingerprint TEXT NOT NULL,
+		    status INTEGER,
+		    content_type TEXT,
+		    body BYTEA,
+		    created_at TIMESTAMPTZ NOT NULL)`,
+	)
+	return err
+}
+
+// Begin implements Store. An expired key or an abandoned reservation is taken over
+// in the same statement that reserves a new key.
+func (s *PostgresStore) Begin(ctx context.Context, key, fingerprint string) (*Result, error) {
+	now := time.Now()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, fingerprint, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO UPDATE SET
+		    fingerprint = EXCLUDED.fingerprint, status = NULL, content_type = NULL,
+		    body = NULL, created_at = EXCLUDED.created_at
+		WHERE (idempotency_keys.status IS NULL AND idempotency_keys.created_at < $4)
+		   OR (idempotency_keys.status IS NOT NULL AND idempotency_keys.created_at < $5)`,
+		key, fingerprint, now, now.Add(-lockTimeout), now.Add(-s.ttl),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 1 {
+		return nil, nil
+	}
+
+	var (
+		savedFingerprint string
+		status           sql.NullInt64
+		contentType      sql.NullString
+		body             []byte
+	)
+	err = s.db.QueryRowContext(ctx,
+		`SELECT fingerprint, status, content_type, body FROM idempotency_keys WHERE key = $1`, key,
+	).Scan(&savedFingerprint, &status, &contentType, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Released in the meantime.
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case savedFingerprint != fingerprint:
+		return nil, ErrMismatch
+	case !status.Valid:
+		return nil, ErrInProgress
+	}
+	return &Result{Status: int(status.Int64), ContentType: contentType.String, Body: body}, nil
+}
+
+// Complete implements Store.
+func (s *PostgresStore) Complete(ctx context.Context, key string, res Result) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status = $2, content_type = $3, body = $4, created_at = $5 WHERE key = $1`,
+		key, res.Status, res.ContentType, res.Body, time.Now(),
+	)
+	return err
+}
+
+// CompleteTx implements TxStore.
+func (s *PostgresStore) CompleteTx(ctx context.Context, tx *sql.Tx, key string) error {
+	_, err := tx.ExecContext(ctx,
+		`UPDATE idempotency_keys SET status = $2, created_at = $3 WHERE key = $1 AND status IS NULL`,
+		key, http.StatusOK, time.Now(),
+	)
+	return err
+}
+
+// Release implements Store.
+func (s *PostgresStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND status IS NULL`, key)
+	return err
+}
+
+// DeleteExpired removes the keys older than the TTL. It should be called periodically
+// to keep the table small.
+func (s *PostgresStore) DeleteExpired(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE created_at < $1`, time.Now().Add(-max(s.ttl, lockTimeout)))
+	return err
+}
@@ -0,0 +1,53 @@
+// Package idempotency remembers the results of requests sent with an idempotency
+// key, so a repeated request returns the original result instead of being applied again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// DefaultTTL is how long the result of a request is remembered.
+const DefaultTTL = 24 * time.Hour
+
+// lockTimeout is how long a key stays reserved by a request that never completed,
+// e.g. because the server was stopped while applying it.
+const lockTimeout = time.Minute
+
+var (
+	// ErrInProgress is returned by Store.Begin while another request with the same key
+	// is being applied.
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+
+	// ErrMismatch is returned by Store.Begin when the key was used for a different request.
+	ErrMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// Result is the saved response of an applied request.
+type Result struct {
+	// Status is the HTTP status code.
+	Status int
+	// ContentType is the value of the Content-Type response header.
+	ContentType string
+	// Body is the uncompressed response body.
+	Body []byte
+}
+
+// Store keeps the results of requests by idempotency key.
+//
+// A request reserves its key with Begin. The reservation is then either completed
+// with the result of the request, or released if the request failed and may be retried.
+type Store interface {
+	// Begin reserves the key for a request with the given fingerprint, a hash of the
+	// request identifying repeats. It returns the saved result if the key was already
+	// completed, nil if the key is reserved for the caller, ErrInProgress if it is
+	// reserved by another request, or ErrMismatch if it was used with another fingerprint.
+	Begin(ctx context.Context, key, fingerprint string) (*Result, error)
+
+	// Complete saves the result of a reserved key.
+	Complete(ctx context.Context, key string, res Result) error
+
+	// Release removes the reservation of a key, so the request can be retried.
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,42 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TxStore is a Store whose keys can be completed in the database transaction that
+// applies the request, so a key is never left reserved for a request whose changes
+// were committed.
+type TxStore interface {
+	Store
+
+	// CompleteTx saves a provisional result, HTTP 200 with an empty body, of a reserved
+	// key in tx. Complete replaces it with the actual response later.
+	CompleteTx(ctx context.Context, tx *sql.Tx, key string) error
+}
+
+// contextKey is the context key of the reserved key of a request.
+type contextKey struct{}
+
+// reservation is a key reserved in a TxStore.
+type reservation struct {
+	store TxStore
+	key   string
+}
+
+// ContextWithKey returns a context carrying a key reserved in store, which is
+// completed by CompleteInTx.
+func ContextWithKey(ctx context.Context, store TxStore, key string) context.Context {
+	return context.WithValue(ctx, contextKey{}, reservation{store: store, key: key})
+}
+
+// CompleteInTx completes the key carried by ctx, if any, in tx. Storages call it
+// before committing the changes of a request.
+func CompleteInTx(ctx context.Context, tx *sql.Tx) error {
+	r, ok := ctx.Value(contextKey{}).(reservation)
+	if !ok {
+		return nil
+	}
+	return r.store.CompleteTx(ctx, tx, r.key)
+}
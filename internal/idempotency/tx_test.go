@@ -0,0 +1,31 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// txStore records the keys completed by CompleteTx.
+type txStore struct {
+	*MemoryStore
+	completed []string
+}
+
+func (s *txStore) CompleteTx(_ context.Context, _ *sql.Tx, key string) error {
+	s.completed = append(s.completed, key)
+	return nil
+}
+
+func TestCompleteInTx(t *testing.T) {
+	store := &txStore{MemoryStore: NewMemoryStore(0)}
+
+	assert.NoError(t, CompleteInTx(context.Background(), nil))
+	assert.Empty(t, store.completed, "a context without a key is ignored")
+
+	ctx := ContextWithKey(context.Background(), store, "k1")
+	assert.NoError(t, CompleteInTx(ctx, nil))
+	assert.Equal(t, []string{"k1"}, store.completed)
+}
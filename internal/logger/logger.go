@@ -53,6 +53,22 @@ func Initialize(level string, env string) error {
 	return nil
 }
 
+// SetLevel changes the log level of the global logger.
+//
+// Parameters:
+//   - level: Log level string ("debug", "info", "warn", "error", "fatal", "panic")
+//
+// Returns:
+//   - error: If the log level cannot be parsed; the current level is kept
+func SetLevel(level string) error {
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	Log.SetLevel(lvl)
+	return nil
+}
+
 // responseData holds metadata about the HTTP response for logging purposes.
 type (
 	responseData struct {
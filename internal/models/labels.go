@@ -0,0 +1,114 @@
+package models
+
+import (
+	"sort"
+	"strings"
+)
+
+// WithLabels builds a metric ID from a name and a set of labels.
+//
+// Labels are appended to the name in the Prometheus style with keys sorted
+// alphabetically, so equal label sets always produce equal IDs. Quotes and
+// backslashes in label values are escaped. Without labels the name is returned as is.
+//
+// Example output:
+//   - WithLabels("DiskFree", {"mountpoint": "/", "fstype": "ext4"}) -> `DiskFree{fstype="ext4",mountpoint="/"}`
+//   - WithLabels("PollCount", nil) -> "PollCount"
+func WithLabels(name string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	sb.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(k)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabelValue(labels[k]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// SplitLabels splits a metric ID built by WithLabels into the name and the labels.
+//
+// IDs without a well-formed label suffix are returned as the name with nil labels.
+//
+// Example output:
+//   - SplitLabels(`DiskFree{mountpoint="/"}`) -> "DiskFree", {"mountpoint": "/"}
+//   - SplitLabels("PollCount") -> "PollCount", nil
+func SplitLabels(id string) (string, map[string]string) {
+	start := strings.IndexByte(id, '{')
+	if start <= 0 || !strings.HasSuffix(id, "}") {
+		return id, nil
+	}
+
+	labels := make(map[string]string)
+	rest := id[start+1 : len(id)-1]
+	for rest != "" {
+		eq := strings.Index(rest, `="`)
+		if eq <= 0 {
+			return id, nil
+		}
+		k := rest[:eq]
+		rest = rest[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(rest); i++ {
+			ch := rest[i]
+			if ch == '\\' && i+1 < len(rest) {
+				i++
+				value.WriteByte(rest[i])
+				continue
+			}
+			if ch == '"' {
+				rest = rest[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(ch)
+		}
+		if !closed {
+			return id, nil
+		}
+		labels[k] = value.String()
+		rest = strings.TrimPrefix(rest, ",")
+	}
+	return id[:start], labels
+}
+
+// AddLabels merges labels into the labels already present in the metric ID.
+// Labels present in the ID take precedence over the added ones.
+func AddLabels(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+	name, existing := SplitLabels(id)
+	merged := make(map[string]string, len(labels)+len(existing))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range existing {
+		merged[k] = v
+	}
+	return WithLabels(name, merged)
+}
+
+func escapeLabelValue(v string) string {
+	if !strings.ContainsAny(v, `"\`) {
+		return v
+	}
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v)
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithLabels(t *testing.T) {
+	assert.Equal(t, "PollCount", WithLabels("PollCount", nil))
+	assert.Equal(t, `DiskFree{fstype="ext4",mountpoint="/"}`,
+		WithLabels("DiskFree", map[string]string{"mountpoint": "/", "fstype": "ext4"}))
+	assert.Equal(t, `Check{name="say \"hi\""}`, WithLabels("Check", map[string]string{"name": `say "hi"`}))
+}
+
+func TestSplitLabels(t *testing.T) {
+	name, labels := SplitLabels(`DiskFree{fstype="ext4",mountpoint="/"}`)
+	assert.Equal(t, "DiskFree", name)
+	assert.Equal(t, map[string]string{"fstype": "ext4", "mountpoint": "/"}, labels)
+
+	name, labels = SplitLabels(`Check{name="say \"hi\", bye"}`)
+	assert.Equal(t, "Check", name)
+	assert.Equal(t, map[string]string{"name": `say "hi", bye`}, labels)
+
+	name, labels = SplitLabels("PollCount")
+	assert.Equal(t, "PollCount", name)
+	assert.Nil(t, labels)
+
+	name, labels = SplitLabels(`Broken{name="x}`)
+	assert.Equal(t, `Broken{name="x}`, name)
+	assert.Nil(t, labels)
+}
+
+func TestAddLabels(t *testing.T) {
+	id := AddLabels(`DiskFree{mountpoint="/"}`, map[string]string{"host": "web1", "mountpoint": "/data"})
+	assert.Equal(t, `DiskFree{host="web1",mountpoint="/"}`, id)
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// Statistics of gauge samples reported by Aggregator.
+const (
+	// StatLast is the last sample, reported under the original metric ID.
+	StatLast = "last"
+	// StatMin is the smallest sample.
+	StatMin = "min"
+	// StatMax is the largest sample.
+	StatMax = "max"
+	// StatMean is the arithmetic mean of the samples.
+	StatMean = "mean"
+	// StatP95 is the 95th percentile of the samples (nearest rank).
+	StatP95 = "p95"
+)
+
+// AggregationStats lists all statistics supported by Aggregator.
+var AggregationStats = []string{StatLast, StatMin, StatMax, StatMean, StatP95}
+
+// Aggregator accumulates the metrics polled during a report interval.
+//
+// Gauge samples are reduced to the configured statistics. The last sample keeps
+// the original metric ID, other statistics are derived gauges labeled with stat,
+// e.g. `HeapAlloc{stat="max"}`. Counter deltas are summed.
+//
+// Aggregator is not safe for concurrent use.
+type Aggregator struct {
+	stats    []string
+	gauges   map[string][]float64
+	counters map[string]int64
+}
+
+// NewAggregator creates an aggregator reporting the given gauge statistics.
+//
+// Returns an error for an unknown statistic or an empty list.
+//
+// Example usage:
+//
+//	agg, err := metrics.NewAggregator([]string{metrics.StatLast, metrics.StatMax})
+//	agg.Add(batch)
+//	report := agg.Flush()
+func NewAggregator(stats []string) (*Aggregator, error) {
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("no aggregation statistics")
+	}
+	for _, s := range stats {
+		if !slices.Contains(AggregationStats, s) {
+			return nil, fmt.Errorf("unknown aggregation statistic %q, known statistics: %v", s, AggregationStats)
+		}
+	}
+	return &Aggregator{
+		stats:    stats,
+		gauges:   make(map[string][]float64),
+		counters: make(map[string]int64),
+	}, nil
+}
+
+// Add records a polled batch.
+func (a *Aggregator) Add(batch []models.Metric) {
+	for _, m := range batch {
+		switch {
+		case m.MType == models.GaugeMetricName && m.Value != nil:
+			a.gauges[m.ID] = append(a.gauges[m.ID], *m.Value)
+		case m.MType == models.CounterMetricName && m.Delta != nil:
+			a.counters[m.ID] += *m.Delta
+		}
+	}
+}
+
+// Flush returns the aggregated metrics of the interval and starts a new one.
+// Metrics without samples in the interval are not reported.
+func (a *Aggregator) Flush() []models.Metric {
+	report := make([]models.Metric, 0, len(a.gauges)*len(a.stats)+len(a.counters))
+	for id, samples := range a.gauges {
+		for _, stat := range a.stats {
+			value := aggregate(stat, samples)
+			statID := id
+			if stat != StatLast {
+				statID = models.AddLabels(id, map[string]string{"stat": stat})
+			}
+			report = append(report, models.Metric{ID: statID, MType: models.GaugeMetricName, Value: &value})
+		}
+	}
+	for id, delta := range a.counters {
+		report = append(report, models.Metric{ID: id, MType: models.CounterMetricName, Delta: &delta})
+	}
+
+	clear(a.gauges)
+	clear(a.counters)
+	return report
+}
+
+// Len returns the number of metrics recorded in the current interval.
+func (a *Aggregator) Len() int {
+	return len(a.gauges) + len(a.counters)
+}
+
+// aggregate computes a statistic of non-empty samples.
+func aggregate(stat string, samples []float64) float64 {
+	switch stat {
+	case StatMin:
+		return slices.Min(samples)
+	case StatMax:
+		return slices.Max(samples)
+	case StatMean:
+		sum := 0.0
+		for _, v := range samples {
+			sum += v
+		}
+		return sum / float64(len(samples))
+	case StatP95:
+		sorted := slices.Clone(samples)
+		slices.Sort(sorted)
+		rank := int(math.Ceil(0.95*float64(len(sorted)))) - 1
+		return sorted[max(rank, 0)]
+	default:
+		return samples[len(samples)-1]
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	agg, err := NewAggregator(AggregationStats)
+	require.NoError(t, err)
+
+	for i := 1; i <= 20; i++ {
+		agg.Add([]models.Metric{
+			{ID: `HeapAlloc{host="a"}`, MType: models.GaugeMetricName, Value: ptr(float64(i))},
+			{ID: "PollCount", MType: models.CounterMetricName, Delta: ptr(int64(1))},
+		})
+	}
+	agg.Add([]models.Metric{{ID: "HeapAlloc", MType: models.GaugeMetricName, Value: ptr(5.0)}})
+	assert.Equal(t, 3, agg.Len())
+
+	got := metricsByID(agg.Flush())
+	assert.Len(t, got, 11)
+	assert.Equal(t, 20.0, *got[`HeapAlloc{host="a"}`].Value)
+	assert.Equal(t, 1.0, *got[`HeapAlloc{host="a",stat="min"}`].Value)
+	assert.Equal(t, 20.0, *got[`HeapAlloc{host="a",stat="max"}`].Value)
+	assert.Equal(t, 10.5, *got[`HeapAlloc{host="a",stat="mean"}`].Value)
+	assert.Equal(t, 19.0, *got[`HeapAlloc{host="a",stat="p95"}`].Value)
+	assert.Equal(t, 5.0, *got[`HeapAlloc{stat="p95"}`].Value)
+	assert.Equal(t, int64(20), *got["PollCount"].Delta)
+
+	assert.Empty(t, agg.Flush())
+}
+
+func TestAggregator_PollCount(t *testing.T) {
+	agg, err := NewAggregator([]string{StatLast})
+	require.NoError(t, err)
+	c := NewPollCountCollector()
+	for range 2 {
+		batch, err := c.Collect(context.Background())
+		require.NoError(t, err)
+		agg.Add(batch)
+	}
+	assert.Equal(t, int64(2), *metricsByID(agg.Flush())["PollCount"].Delta, "two polls add two to PollCount")
+}
+
+func TestNewAggregator_Errors(t *testing.T) {
+	_, err := NewAggregator(nil)
+	assert.Error(t, err)
+	_, err = NewAggregator([]string{"last", "p99"})
+	assert.ErrorContains(t, err, `unknown aggregation statistic "p99"`)
+}
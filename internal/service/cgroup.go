@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+const (
+	// DefaultCgroupRoot is the mount point of the cgroup v2 unified hierarchy.
+	DefaultCgroupRoot = "/sys/fs/cgroup"
+
+	// selfCgroupFile lists the cgroups of the agent process.
+	selfCgroupFile = "/proc/self/cgroup"
+)
+
+// cgroupCPUCounters maps cpu.stat keys to the reported counter names.
+var cgroupCPUCounters = map[string]string{
+	"usage_usec":     "CgroupCPUUsageUsec",
+	"user_usec":      "CgroupCPUUserUsec",
+	"system_usec":    "CgroupCPUSystemUsec",
+	"nr_throttled":   "CgroupCPUThrottled",
+	"throttled_usec": "CgroupCPUThrottledUsec",
+}
+
+// cgroupIOCounters maps io.stat keys to the reported counter names.
+var cgroupIOCounters = map[string]string{
+	"rbytes": "CgroupIOReadBytes",
+	"wbytes": "CgroupIOWriteBytes",
+	"rios":   "CgroupIOReads",
+	"wios":   "CgroupIOWrites",
+}
+
+// CgroupCollector reports resource usage of cgroup v2 groups.
+//
+// Reported gauges, labeled with cgroup:
+//   - CgroupMemoryCurrent: memory.current in bytes
+//   - CgroupMemoryMax: memory.max in bytes, omitted when unlimited
+//   - CgroupPids: pids.current
+//
+// Reported counters as deltas since the previous poll:
+//   - CgroupCPUUsageUsec, CgroupCPUUserUsec, CgroupCPUSystemUsec, CgroupCPUThrottled,
+//     CgroupCPUThrottledUsec from cpu.stat, labeled with cgroup
+//   - CgroupIOReadBytes, CgroupIOWriteBytes, CgroupIOReads, CgroupIOWrites from io.stat,
+//     labeled with cgroup and device ("major:minor")
+//
+// Files of disabled controllers are skipped. The first Collect call only records the counters.
+type CgroupCollector struct {
+	root     string
+	cgroups  []string
+	selfFile string
+
+	prev map[string]uint64
+}
+
+// NewCgroupCollector creates a collector named "cgroup".
+//
+// Parameters:
+//   - root: mount point of the cgroup v2 hierarchy; empty means DefaultCgroupRoot
+//   - cgroups: cgroup paths relative to root, e.g. "/system.slice/nginx.service";
+//     empty means the cgroup of the agent itself
+func NewCgroupCollector(root string, cgroups []string) *CgroupCollector {
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+	return &CgroupCollector{root: root, cgroups: cgroups, selfFile: selfCgroupFile}
+}
+
+// Name returns "cgroup".
+func (c *CgroupCollector) Name() string {
+	return "cgroup"
+}
+
+// Collect reads the cgroup files. It returns an error if a configured cgroup directory
+// does not exist.
+//
+// Without configured cgroups no metrics are returned on hosts without a cgroup v2
+// hierarchy, so the default collector stays quiet there.
+func (c *CgroupCollector) Collect(_ context.Context) ([]models.Metric, error) {
+	cgroups := c.cgroups
+	if len(cgroups) == 0 {
+		self, ok, err := readSelfCgroup(c.selfFile)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, nil
+		}
+		if _, err := os.Stat(filepath.Join(c.root, filepath.FromSlash(self))); err != nil {
+			// A hybrid hierarchy: the v2 tree is not mounted at root.
+			return nil, nil
+		}
+		cgroups = []string{self}
+	}
+
+	prev := c.prev
+	c.prev = make(map[string]uint64)
+	var batch []models.Metric
+	counter := func(name string, labels map[string]string, value uint64) {
+		id := models.WithLabels(name, labels)
+		c.prev[id] = value
+		if p, ok := prev[id]; ok {
+			batch = append(batch, labeledCounter(name, labels, counterDelta(p, value)))
+		}
+	}
+
+	for _, cg := range cgroups {
+		dir := filepath.Join(c.root, filepath.FromSlash(cg))
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("cgroup %s: %w", cg, err)
+		}
+		labels := map[string]string{"cgroup": cg}
+
+		if v, ok := readCgroupValue(filepath.Join(dir, "memory.current")); ok {
+			batch = append(batch, labeledGauge("CgroupMemoryCurrent", labels, float64(v)))
+		}
+		if v, ok := readCgroupValue(filepath.Join(dir, "memory.max")); ok {
+			batch = append(batch, labeledGauge("CgroupMemoryMax", labels, float64(v)))
+		}
+		if v, ok := readCgroupValue(filepath.Join(dir, "pids.current")); ok {
+			batch = append(batch, labeledGauge("CgroupPids", labels, float64(v)))
+		}
+
+		for key, value := range readCgroupKeyValues(filepath.Join(dir, "cpu.stat")) {
+			if name, ok := cgroupCPUCounters[key]; ok {
+				counter(name, labels, value)
+			}
+		}
+
+		for device, stats := range readCgroupIOStat(filepath.Join(dir, "io.stat")) {
+			ioLabels := map[string]string{"cgroup": cg, "device": device}
+			for key, value := range stats {
+				if name, ok := cgroupIOCounters[key]; ok {
+					counter(name, ioLabels, value)
+				}
+			}
+		}
+	}
+	return batch, nil
+}
+
+// readSelfCgroup returns the cgroup v2 path of the current process from the
+// "0::/path" line of /proc/self/cgroup. It returns false if the file does not exist
+// or has no such line, i.e. the host has no cgroup v2 hierarchy.
+func readSelfCgroup(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("read own cgroup: %w", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if cg, ok := strings.CutPrefix(line, "0::"); ok {
+			return cg, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// readCgroupValue reads a single-value cgroup file. It returns false if the file
+// is missing or holds "max".
+func readCgroupValue(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
+
+// readCgroupKeyValues reads a flat keyed file such as cpu.stat with "key value" lines.
+func readCgroupKeyValues(path string) map[string]uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if v, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64); err == nil {
+			values[key] = v
+		}
+	}
+	return values
+}
+
+// readCgroupIOStat reads io.stat with "major:minor key=value ..." lines and
+// returns the values indexed by device.
+func readCgroupIOStat(path string) map[string]map[string]uint64 {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	devices := make(map[string]map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		stats := make(map[string]uint64, len(fields)-1)
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			if v, err := strconv.ParseUint(value, 10, 64); err == nil {
+				stats[key] = v
+			}
+		}
+		devices[fields[0]] = stats
+	}
+	return devices
+}
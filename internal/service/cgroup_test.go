@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCgroupFiles creates a fake cgroup directory with the given files.
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestCgroupCollector(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "system.slice", "app.service")
+	writeCgroupFiles(t, dir, map[string]string{
+		"memory.current": "1048576\n",
+		"memory.max":     "max\n",
+		"pids.current":   "7\n",
+		"cpu.stat":       "usage_usec 1000\nuser_usec 600\nsystem_usec 400\nnr_periods 0\n",
+		"io.stat":        "8:0 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0\n",
+	})
+
+	c := NewCgroupCollector(root, []string{"/system.slice/app.service"})
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, 2)
+	assert.Equal(t, 1048576.0, *got[`CgroupMemoryCurrent{cgroup="/system.slice/app.service"}`].Value)
+	assert.Equal(t, 7.0, *got[`CgroupPids{cgroup="/system.slice/app.service"}`].Value)
+
+	writeCgroupFiles(t, dir, map[string]string{
+		"memory.max": "2097152\n",
+		"cpu.stat":   "usage_usec 1500\nuser_usec 900\nsystem_usec 600\n",
+		"io.stat":    "8:0 rbytes=5096 wbytes=8192 rios=3 wios=2\n",
+	})
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.Equal(t, 2097152.0, *got[`CgroupMemoryMax{cgroup="/system.slice/app.service"}`].Value)
+	assert.Equal(t, int64(500), *got[`CgroupCPUUsageUsec{cgroup="/system.slice/app.service"}`].Delta)
+	assert.Equal(t, int64(300), *got[`CgroupCPUUserUsec{cgroup="/system.slice/app.service"}`].Delta)
+	assert.Equal(t, int64(1000), *got[`CgroupIOReadBytes{cgroup="/system.slice/app.service",device="8:0"}`].Delta)
+	assert.Equal(t, int64(0), *got[`CgroupIOWriteBytes{cgroup="/system.slice/app.service",device="8:0"}`].Delta)
+	assert.Equal(t, int64(2), *got[`CgroupIOReads{cgroup="/system.slice/app.service",device="8:0"}`].Delta)
+}
+
+func TestCgroupCollector_Self(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFiles(t, filepath.Join(root, "user.slice"), map[string]string{"pids.current": "3"})
+	self := filepath.Join(t.TempDir(), "cgroup")
+	require.NoError(t, os.WriteFile(self, []byte("0::/user.slice\n"), 0644))
+
+	c := NewCgroupCollector(root, nil)
+	c.selfFile = self
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, *metricsByID(batch)[`CgroupPids{cgroup="/user.slice"}`].Value)
+
+	c = NewCgroupCollector(root, []string{"/missing"})
+	_, err = c.Collect(context.Background())
+	assert.Error(t, err)
+}
+
+func TestCgroupCollector_NoV2(t *testing.T) {
+	self := filepath.Join(t.TempDir(), "cgroup")
+	require.NoError(t, os.WriteFile(self, []byte("12:memory:/user.slice\n1:name=systemd:/user.slice\n"), 0644))
+
+	c := NewCgroupCollector(t.TempDir(), nil)
+	c.selfFile = self
+	batch, err := c.Collect(context.Background())
+	assert.NoError(t, err, "a cgroup v1 host is not an error")
+	assert.Empty(t, batch)
+
+	c.selfFile = filepath.Join(t.TempDir(), "missing")
+	batch, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, batch)
+}
@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// CollectorErrorsMetricName is the name of the counter reporting failed collections.
+// It is labeled with the collector name, e.g. `CollectorErrors{collector="system"}`.
+const CollectorErrorsMetricName = "CollectorErrors"
+
+// Collector is a source of metrics polled by the agent.
+//
+// Implementations must be safe to call from a single goroutine repeatedly;
+// the registry never calls Collect of the same collector concurrently.
+type Collector interface {
+	// Name returns the unique collector name used in the agent configuration.
+	Name() string
+
+	// Collect gathers the current metrics. It should stop when ctx is done.
+	Collect(ctx context.Context) ([]models.Metric, error)
+}
+
+// CollectorOptions holds the registry settings of a single collector.
+type CollectorOptions struct {
+	// Interval is the poll interval of the collector.
+	Interval time.Duration
+
+	// Timeout limits a single Collect call. Zero means Interval.
+	Timeout time.Duration
+
+	// Filter selects the metrics reported by the collector.
+	Filter Filter
+}
+
+// registration is a collector registered in the Registry.
+type registration struct {
+	collector Collector
+	opts      CollectorOptions
+	// inflight is held while a Collect call is running, including calls
+	// abandoned after their timeout.
+	inflight chan struct{}
+
+	mu sync.Mutex
+	// late holds the result of a call that finished after its timeout,
+	// delivered with the next poll.
+	late []models.Metric
+}
+
+// takeLate returns and clears the result of a call that finished after its timeout.
+func (reg *registration) takeLate() []models.Metric {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	late := reg.late
+	reg.late = nil
+	return late
+}
+
+// Registry runs registered collectors on their own intervals and forwards
+// the collected metrics.
+//
+// Every collector runs in its own goroutine. A Collect call that fails or exceeds
+// its timeout is logged and counted as a CollectorErrors delta of the
+// collector, which is sent along with the metrics. The metrics of a call that
+// finishes after its timeout are sent with the next poll, so the counter deltas
+// of stateful collectors are not lost.
+type Registry struct {
+	mu            sync.Mutex
+	registrations []*registration
+	relabeler     Relabeler
+}
+
+// NewRegistry creates an empty collector registry.
+//
+// Parameters:
+//   - relabeler: renames and labels applied to the metrics of all collectors
+//
+// Example usage:
+//
+//	registry := metrics.NewRegistry(metrics.Relabeler{})
+//	_ = registry.Register(metrics.NewRuntimeCollector(), metrics.CollectorOptions{Interval: 2 * time.Second})
+//	registry.Run(ctx, out)
+func NewRegistry(relabeler Relabeler) *Registry {
+	return &Registry{relabeler: relabeler}
+}
+
+// Register adds a collector to the registry.
+//
+// Returns an error if a collector with the same name is already registered
+// or the interval is not positive.
+func (r *Registry) Register(c Collector, opts CollectorOptions) error {
+	if opts.Interval <= 0 {
+		return fmt.Errorf("collector %q: poll interval must be positive", c.Name())
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = opts.Interval
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, reg := range r.registrations {
+		if reg.collector.Name() == c.Name() {
+			return fmt.Errorf("collector %q is already registered", c.Name())
+		}
+	}
+	r.registrations = append(r.registrations, &registration{
+		collector: c,
+		opts:      opts,
+		inflight:  make(chan struct{}, 1),
+	})
+	return nil
+}
+
+// Names returns the names of the registered collectors in registration order.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.registrations))
+	for _, reg := range r.registrations {
+		names = append(names, reg.collector.Name())
+	}
+	return names
+}
+
+// Run polls all registered collectors and sends every collected batch to out.
+// It blocks until ctx is done and all collector goroutines have stopped.
+func (r *Registry) Run(ctx context.Context, out chan<- []models.Metric) {
+	r.mu.Lock()
+	registrations := append([]*registration(nil), r.registrations...)
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, reg := range registrations {
+		wg.Add(1)
+		go func(reg *registration) {
+			defer wg.Done()
+			r.poll(ctx, reg, out)
+		}(reg)
+	}
+	wg.Wait()
+}
+
+// poll runs a single collector on its interval until ctx is done.
+func (r *Registry) poll(ctx context.Context, reg *registration, out chan<- []models.Metric) {
+	ticker := time.NewTicker(reg.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			batch := r.collectOnce(ctx, reg)
+			if len(batch) == 0 {
+				continue
+			}
+			select {
+			case out <- batch:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// collectOnce runs a single Collect call of the registered collector with its
+// timeout and returns the filtered and relabeled metrics, preceded by the late
+// result of a previous call. On failure the batch contains the late result and
+// the CollectorErrors counter of the collector.
+func (r *Registry) collectOnce(ctx context.Context, reg *registration) []models.Metric {
+	name := reg.collector.Name()
+	late := reg.takeLate()
+	batch, err := collectWithTimeout(ctx, reg, reg.opts.Timeout)
+	if err != nil {
+		log.Printf("Collector %s failed: %v", name, err)
+		failures := int64(1)
+		return r.relabeler.Apply(append(reg.opts.Filter.Apply(late), models.Metric{
+			ID:    models.WithLabels(CollectorErrorsMetricName, map[string]string{"collector": name}),
+			MType: models.CounterMetricName,
+			Delta: &failures,
+		}))
+	}
+	return r.relabeler.Apply(reg.opts.Filter.Apply(append(late, batch...)))
+}
+
+// collectWithTimeout calls Collect in a separate goroutine so that a collector
+// ignoring its context cannot block the poll loop longer than the timeout.
+// A new call is not started while an abandoned one is still running; the result
+// of an abandoned call is kept in reg.late.
+func collectWithTimeout(ctx context.Context, reg *registration, timeout time.Duration) ([]models.Metric, error) {
+	select {
+	case reg.inflight <- struct{}{}:
+	default:
+		return nil, fmt.Errorf("previous collection is still running")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		batch []models.Metric
+		err   error
+	}
+	var (
+		mu        sync.Mutex
+		abandoned bool
+	)
+	done := make(chan result, 1)
+	go func() {
+		batch, err := reg.collector.Collect(ctx)
+		mu.Lock()
+		if !abandoned {
+			done <- result{batch: batch, err: err}
+		} else if err == nil {
+			reg.mu.Lock()
+			reg.late = append(reg.late, batch...)
+			reg.mu.Unlock()
+		}
+		mu.Unlock()
+		<-reg.inflight
+	}()
+
+	select {
+	case res := <-done:
+		return res.batch, res.err
+	case <-ctx.Done():
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case res := <-done:
+		return res.batch, res.err
+	default:
+		abandoned = true
+		return nil, fmt.Errorf("collection timed out after %s: %w", timeout, ctx.Err())
+	}
+}
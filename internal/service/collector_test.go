@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeCollector struct {
+	name  string
+	batch []models.Metric
+	err   error
+	delay time.Duration
+}
+
+func (c *fakeCollector) Name() string {
+	return c.name
+}
+
+func (c *fakeCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	if c.delay > 0 {
+		time.Sleep(c.delay)
+	}
+	return c.batch, c.err
+}
+
+func TestRegistry_Register(t *testing.T) {
+	r := NewRegistry(Relabeler{})
+	assert.NoError(t, r.Register(&fakeCollector{name: "a"}, CollectorOptions{Interval: time.Second}))
+	assert.Error(t, r.Register(&fakeCollector{name: "a"}, CollectorOptions{Interval: time.Second}))
+	assert.Error(t, r.Register(&fakeCollector{name: "b"}, CollectorOptions{}))
+	assert.Equal(t, []string{"a"}, r.Names())
+}
+
+func TestRegistry_CollectOnce(t *testing.T) {
+	v := 1.0
+	c := &fakeCollector{name: "fake", batch: []models.Metric{
+		{ID: "HeapAlloc", MType: models.GaugeMetricName, Value: &v},
+		{ID: "Alloc", MType: models.GaugeMetricName, Value: &v},
+	}}
+	r := NewRegistry(Relabeler{Labels: map[string]string{"host": "web1"}})
+	assert.NoError(t, r.Register(c, CollectorOptions{Interval: time.Second, Filter: Filter{Include: []string{"Heap*"}}}))
+
+	batch := r.collectOnce(context.Background(), r.registrations[0])
+	assert.Len(t, batch, 1)
+	assert.Equal(t, `HeapAlloc{host="web1"}`, batch[0].ID)
+
+	c.err = errors.New("boom")
+	batch = r.collectOnce(context.Background(), r.registrations[0])
+	batch = r.collectOnce(context.Background(), r.registrations[0])
+	assert.Len(t, batch, 1)
+	assert.Equal(t, `CollectorErrors{collector="fake",host="web1"}`, batch[0].ID)
+	assert.Equal(t, int64(1), *batch[0].Delta, "every failure is reported as a separate delta")
+}
+
+func TestRegistry_CollectErrorsSum(t *testing.T) {
+	c := &fakeCollector{name: "fake", err: errors.New("boom")}
+	r := NewRegistry(Relabeler{})
+	assert.NoError(t, r.Register(c, CollectorOptions{Interval: time.Second}))
+
+	var total int64
+	for range 3 {
+		batch := r.collectOnce(context.Background(), r.registrations[0])
+		assert.Len(t, batch, 1)
+		total += *batch[0].Delta
+	}
+	assert.Equal(t, int64(3), total, "the server total equals the number of failures")
+}
+
+func TestRegistry_CollectTimeout(t *testing.T) {
+	c := &fakeCollector{name: "slow", delay: 200 * time.Millisecond}
+	r := NewRegistry(Relabeler{})
+	assert.NoError(t, r.Register(c, CollectorOptions{Interval: time.Second, Timeout: 20 * time.Millisecond}))
+
+	start := time.Now()
+	batch := r.collectOnce(context.Background(), r.registrations[0])
+	assert.Less(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, `CollectorErrors{collector="slow"}`, batch[0].ID)
+
+	// the abandoned call is still running, so the next one is not started
+	batch = r.collectOnce(context.Background(), r.registrations[0])
+	assert.Equal(t, `CollectorErrors{collector="slow"}`, batch[0].ID)
+	assert.Equal(t, int64(1), *batch[0].Delta)
+}
+
+func TestRegistry_LateResult(t *testing.T) {
+	d := int64(3)
+	c := &fakeCollector{name: "slow", delay: 50 * time.Millisecond, batch: []models.Metric{
+		{ID: "DiskReads", MType: models.CounterMetricName, Delta: &d},
+	}}
+	r := NewRegistry(Relabeler{})
+	assert.NoError(t, r.Register(c, CollectorOptions{Interval: time.Second, Timeout: 10 * time.Millisecond}))
+
+	batch := r.collectOnce(context.Background(), r.registrations[0])
+	assert.Equal(t, []string{`CollectorErrors{collector="slow"}`}, metricIDs(batch))
+
+	time.Sleep(100 * time.Millisecond)
+	r.registrations[0].opts.Timeout = time.Second
+	batch = r.collectOnce(context.Background(), r.registrations[0])
+	assert.Equal(t, []string{"DiskReads", "DiskReads"}, metricIDs(batch), "the late result is sent with the next poll")
+	assert.Empty(t, r.collectOnce(context.Background(), r.registrations[0])[1:], "the late result is sent once")
+}
+
+func metricIDs(batch []models.Metric) []string {
+	ids := make([]string, 0, len(batch))
+	for _, m := range batch {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestRegistry_Run(t *testing.T) {
+	r := NewRegistry(Relabeler{})
+	assert.NoError(t, r.Register(NewPollCountCollector(), CollectorOptions{Interval: 10 * time.Millisecond}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan []models.Metric)
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx, out)
+		close(done)
+	}()
+
+	batch := <-out
+	assert.Equal(t, "PollCount", batch[0].ID)
+	batch = <-out
+	assert.Equal(t, int64(1), *batch[0].Delta, "PollCount is a delta per poll")
+	cancel()
+	<-done
+}
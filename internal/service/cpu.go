@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/shirou/gopsutil/v4/cpu"
+)
+
+// CPUCollector reports CPU utilization in percent computed from the CPU time
+// counters between two consecutive polls, so a Collect call never blocks for
+// a sample window.
+//
+// Reported gauges:
+//   - CPUutilization1..CPUutilizationN: busy time of every core (1-based)
+//   - CPUUser, CPUSystem, CPUIowait, CPUSteal: share of the time of all cores
+//
+// The first Collect call only records the counters and returns no metrics.
+type CPUCollector struct {
+	times    func(ctx context.Context, perCPU bool) ([]cpu.TimesStat, error)
+	prevCore []cpu.TimesStat
+	prevAll  *cpu.TimesStat
+}
+
+// NewCPUCollector creates a collector named "cpu".
+func NewCPUCollector() *CPUCollector {
+	return &CPUCollector{times: cpu.TimesWithContext}
+}
+
+// Name returns "cpu".
+func (c *CPUCollector) Name() string {
+	return "cpu"
+}
+
+// Collect returns the CPU utilization since the previous call.
+func (c *CPUCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	cores, err := c.times(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("read per-core cpu times: %w", err)
+	}
+	all, err := c.times(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("read total cpu times: %w", err)
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("read total cpu times: no data")
+	}
+
+	prevCore, prevAll := c.prevCore, c.prevAll
+	c.prevCore, c.prevAll = cores, &all[0]
+	if prevAll == nil {
+		return nil, nil
+	}
+
+	gauges := make(map[string]float64, len(cores)+4)
+	// The number of cores may change between polls (CPU hotplug);
+	// such polls only refresh the baseline for the cores.
+	if len(prevCore) == len(cores) {
+		for i := range cores {
+			gauges["CPUutilization"+strconv.Itoa(i+1)] = cpuBusyPercent(prevCore[i], cores[i])
+		}
+	}
+
+	elapsed := cpuTotal(all[0]) - cpuTotal(*prevAll)
+	share := func(prev, cur float64) float64 {
+		if elapsed <= 0 {
+			return 0
+		}
+		return math.Min(100, math.Max(0, (cur-prev)/elapsed*100))
+	}
+	gauges["CPUUser"] = share(prevAll.User, all[0].User)
+	gauges["CPUSystem"] = share(prevAll.System, all[0].System)
+	gauges["CPUIowait"] = share(prevAll.Iowait, all[0].Iowait)
+	gauges["CPUSteal"] = share(prevAll.Steal, all[0].Steal)
+	return gaugeBatch(gauges), nil
+}
+
+// cpuTotal returns the total CPU time of a sample. Guest time is already
+// included in user time on Linux and is not counted twice.
+func cpuTotal(t cpu.TimesStat) float64 {
+	return t.User + t.Nice + t.System + t.Idle + t.Iowait + t.Irq + t.Softirq + t.Steal
+}
+
+// cpuBusyPercent returns the share of non-idle time between two samples of the same core.
+func cpuBusyPercent(prev, cur cpu.TimesStat) float64 {
+	prevTotal, curTotal := cpuTotal(prev), cpuTotal(cur)
+	prevBusy, curBusy := prevTotal-prev.Idle-prev.Iowait, curTotal-cur.Idle-cur.Iowait
+	if curTotal <= prevTotal || curBusy <= prevBusy {
+		return 0
+	}
+	return math.Min(100, (curBusy-prevBusy)/(curTotal-prevTotal)*100)
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUCollector(t *testing.T) {
+	samples := [][]cpu.TimesStat{
+		{
+			{CPU: "cpu0", User: 10, Idle: 90},
+			{CPU: "cpu1", User: 50, Idle: 50},
+		},
+		{
+			{CPU: "cpu0", User: 40, System: 10, Idle: 140, Iowait: 10},
+			{CPU: "cpu1", User: 50, Idle: 150, Steal: 0},
+		},
+	}
+	poll := 0
+	c := &CPUCollector{times: func(_ context.Context, perCPU bool) ([]cpu.TimesStat, error) {
+		cores := samples[poll]
+		if perCPU {
+			return cores, nil
+		}
+		all := cpu.TimesStat{CPU: "cpu-total"}
+		for _, core := range cores {
+			all.User += core.User
+			all.System += core.System
+			all.Idle += core.Idle
+			all.Iowait += core.Iowait
+			all.Steal += core.Steal
+		}
+		poll++
+		return []cpu.TimesStat{all}, nil
+	}}
+
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, batch)
+
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got := make(map[string]float64)
+	for _, m := range batch {
+		assert.Equal(t, models.GaugeMetricName, m.MType)
+		got[m.ID] = *m.Value
+	}
+	assert.InDelta(t, 40.0, got["CPUutilization1"], 1e-9)
+	assert.InDelta(t, 0.0, got["CPUutilization2"], 1e-9)
+	assert.InDelta(t, 15.0, got["CPUUser"], 1e-9)
+	assert.InDelta(t, 5.0, got["CPUSystem"], 1e-9)
+	assert.InDelta(t, 5.0, got["CPUIowait"], 1e-9)
+	assert.InDelta(t, 0.0, got["CPUSteal"], 1e-9)
+}
+
+func TestCPUBusyPercent(t *testing.T) {
+	prev := cpu.TimesStat{User: 10, Idle: 10}
+	assert.Equal(t, 0.0, cpuBusyPercent(prev, prev))
+	assert.Equal(t, 100.0, cpuBusyPercent(prev, cpu.TimesStat{User: 20, Idle: 10}))
+	assert.Equal(t, 0.0, cpuBusyPercent(prev, cpu.TimesStat{User: 5, Idle: 5}))
+}
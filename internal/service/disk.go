@@ -0,0 +1,158 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/shirou/gopsutil/v4/disk"
+)
+
+// DiskCollector reports filesystem usage per mount point and I/O statistics per block device.
+//
+// Reported gauges, labeled with mountpoint and fstype:
+//   - DiskTotal, DiskFree, DiskUsed: filesystem size in bytes
+//   - DiskInodesTotal, DiskInodesFree, DiskInodesUsed: number of inodes
+//
+// Reported counters, labeled with device, as deltas since the previous poll:
+//   - DiskReadBytes, DiskWriteBytes: transferred bytes
+//   - DiskReads, DiskWrites: completed operations
+//
+// Only physical filesystems are reported. The first Collect call only records
+// the I/O counters, and a device whose counters went backwards reports the new
+// value as the delta.
+type DiskCollector struct {
+	mountpoints Filter
+	fstypes     Filter
+
+	partitions func(ctx context.Context, all bool) ([]disk.PartitionStat, error)
+	usage      func(ctx context.Context, path string) (*disk.UsageStat, error)
+	ioCounters func(ctx context.Context, names ...string) (map[string]disk.IOCountersStat, error)
+
+	prevIO map[string]disk.IOCountersStat
+}
+
+// NewDiskCollector creates a collector named "disk".
+//
+// Parameters:
+//   - mountpoints: selects filesystems by mount point, e.g. Include: ["/", "/mnt/*"]
+//   - fstypes: selects filesystems by type, e.g. Exclude: ["tmpfs", "overlay"]
+//
+// Patterns use the path.Match syntax and are matched against the whole value.
+func NewDiskCollector(mountpoints, fstypes Filter) *DiskCollector {
+	return &DiskCollector{
+		mountpoints: mountpoints,
+		fstypes:     fstypes,
+		partitions:  disk.PartitionsWithContext,
+		usage:       disk.UsageWithContext,
+		ioCounters:  disk.IOCountersWithContext,
+	}
+}
+
+// Name returns "disk".
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+// Collect returns the filesystem usage and the I/O counter deltas since the previous call.
+// Filesystems that cannot be read are skipped; an error is returned only if the
+// partitions or the I/O counters cannot be listed.
+func (c *DiskCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	partitions, err := c.partitions(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+
+	var batch []models.Metric
+	devices := make(map[string]struct{})
+	seen := make(map[string]struct{})
+	for _, p := range partitions {
+		if _, ok := seen[p.Mountpoint]; ok {
+			continue
+		}
+		if !matchFilter(c.mountpoints, p.Mountpoint) || !matchFilter(c.fstypes, p.Fstype) {
+			continue
+		}
+		seen[p.Mountpoint] = struct{}{}
+		devices[deviceName(p.Device)] = struct{}{}
+
+		u, err := c.usage(ctx, p.Mountpoint)
+		if err != nil {
+			continue
+		}
+		labels := map[string]string{"mountpoint": p.Mountpoint, "fstype": p.Fstype}
+		batch = append(batch,
+			labeledGauge("DiskTotal", labels, float64(u.Total)),
+			labeledGauge("DiskFree", labels, float64(u.Free)),
+			labeledGauge("DiskUsed", labels, float64(u.Used)),
+			labeledGauge("DiskInodesTotal", labels, float64(u.InodesTotal)),
+			labeledGauge("DiskInodesFree", labels, float64(u.InodesFree)),
+			labeledGauge("DiskInodesUsed", labels, float64(u.InodesUsed)),
+		)
+	}
+
+	counters, err := c.ioCounters(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read disk io counters: %w", err)
+	}
+	prevIO := c.prevIO
+	c.prevIO = counters
+	if prevIO == nil {
+		return batch, nil
+	}
+	for name, cur := range counters {
+		if _, ok := devices[name]; !ok {
+			continue
+		}
+		prev, ok := prevIO[name]
+		if !ok {
+			continue
+		}
+		labels := map[string]string{"device": name}
+		batch = append(batch,
+			labeledCounter("DiskReadBytes", labels, counterDelta(prev.ReadBytes, cur.ReadBytes)),
+			labeledCounter("DiskWriteBytes", labels, counterDelta(prev.WriteBytes, cur.WriteBytes)),
+			labeledCounter("DiskReads", labels, counterDelta(prev.ReadCount, cur.ReadCount)),
+			labeledCounter("DiskWrites", labels, counterDelta(prev.WriteCount, cur.WriteCount)),
+		)
+	}
+	return batch, nil
+}
+
+// deviceName returns the kernel name of a block device used as the key of the
+// I/O counters, resolving symlinks such as /dev/mapper/root -> /dev/dm-0.
+func deviceName(device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	return filepath.Base(device)
+}
+
+// matchFilter reports whether a plain value passes the include and exclude patterns of f.
+// Unlike Filter.Allow it does not strip labels from the value.
+func matchFilter(f Filter, value string) bool {
+	if len(f.Include) > 0 && !matchAny(f.Include, value) {
+		return false
+	}
+	return !matchAny(f.Exclude, value)
+}
+
+// counterDelta returns the increase of a monotonic counter between two samples.
+// A counter that went backwards was reset, so its current value is the increase.
+func counterDelta(prev, cur uint64) int64 {
+	if cur < prev {
+		return int64(cur)
+	}
+	return int64(cur - prev)
+}
+
+// labeledGauge builds a gauge metric with labels folded into its ID.
+func labeledGauge(name string, labels map[string]string, value float64) models.Metric {
+	return models.Metric{ID: models.WithLabels(name, labels), MType: models.GaugeMetricName, Value: &value}
+}
+
+// labeledCounter builds a counter metric with labels folded into its ID.
+func labeledCounter(name string, labels map[string]string, delta int64) models.Metric {
+	return models.Metric{ID: models.WithLabels(name, labels), MType: models.CounterMetricName, Delta: &delta}
+}
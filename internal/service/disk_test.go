@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskCollector(t *testing.T) {
+	io := map[string]disk.IOCountersStat{
+		"sda1": {Name: "sda1", ReadBytes: 1000, WriteBytes: 500, ReadCount: 10, WriteCount: 5},
+		"sdb1": {Name: "sdb1", ReadBytes: 1000},
+	}
+	c := NewDiskCollector(Filter{Exclude: []string{"/boot*"}}, Filter{Include: []string{"ext4", "xfs"}})
+	c.partitions = func(context.Context, bool) ([]disk.PartitionStat, error) {
+		return []disk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sda1", Mountpoint: "/", Fstype: "ext4"},
+			{Device: "/dev/sda2", Mountpoint: "/boot", Fstype: "ext4"},
+			{Device: "/dev/sdb1", Mountpoint: "/mnt/usb", Fstype: "vfat"},
+		}, nil
+	}
+	c.usage = func(_ context.Context, path string) (*disk.UsageStat, error) {
+		return &disk.UsageStat{Path: path, Total: 100, Free: 40, Used: 60, InodesTotal: 10, InodesFree: 7, InodesUsed: 3}, nil
+	}
+	c.ioCounters = func(context.Context, ...string) (map[string]disk.IOCountersStat, error) {
+		return io, nil
+	}
+
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, 6)
+	assert.Equal(t, 40.0, *got[`DiskFree{fstype="ext4",mountpoint="/"}`].Value)
+	assert.Equal(t, 3.0, *got[`DiskInodesUsed{fstype="ext4",mountpoint="/"}`].Value)
+
+	io = map[string]disk.IOCountersStat{
+		"sda1": {Name: "sda1", ReadBytes: 1500, WriteBytes: 100, ReadCount: 12, WriteCount: 6},
+		"sdb1": {Name: "sdb1", ReadBytes: 2000},
+	}
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.Len(t, got, 10)
+	assert.Equal(t, int64(500), *got[`DiskReadBytes{device="sda1"}`].Delta)
+	assert.Equal(t, int64(100), *got[`DiskWriteBytes{device="sda1"}`].Delta)
+	assert.Equal(t, int64(2), *got[`DiskReads{device="sda1"}`].Delta)
+	assert.Equal(t, int64(1), *got[`DiskWrites{device="sda1"}`].Delta)
+	assert.Equal(t, models.CounterMetricName, got[`DiskWrites{device="sda1"}`].MType)
+	assert.NotContains(t, got, `DiskReadBytes{device="sdb1"}`)
+}
+
+func TestCounterDelta(t *testing.T) {
+	assert.Equal(t, int64(5), counterDelta(10, 15))
+	assert.Equal(t, int64(3), counterDelta(10, 3))
+}
+
+func metricsByID(batch []models.Metric) map[string]models.Metric {
+	res := make(map[string]models.Metric, len(batch))
+	for _, m := range batch {
+		res[m.ID] = m
+	}
+	return res
+}
@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// Script output formats supported by ExecCollector.
+const (
+	// ScriptFormatText is one "name type value" metric per line.
+	ScriptFormatText = "text"
+
+	// ScriptFormatJSON is a JSON array of models.Metric.
+	ScriptFormatJSON = "json"
+)
+
+const (
+	// maxScriptStderr limits the script stderr included in error messages.
+	maxScriptStderr = 512
+
+	// scriptWaitDelay limits waiting for the output of a killed command whose
+	// children still hold its stdout open.
+	scriptWaitDelay = time.Second
+)
+
+// ExecCollector runs an external command and reports the metrics printed to its stdout.
+//
+// In the text format every non-empty line not starting with "#" holds a metric:
+//
+//	# name type value
+//	BackupAge gauge 3600
+//	BackupFailures counter 1
+//	QueueLength{queue="mail"} gauge 12
+//
+// Counter values are increments added to the server total as they are, in the text
+// format as well as in the json format, where delta has the same meaning as in the
+// server API. A command must therefore print the increase since its previous run,
+// not a running total. TextfileCollector reads *.json files with the same meaning.
+//
+// The command is killed when the collection context is done. A command that fails,
+// times out or prints invalid output makes Collect return an error, which the
+// registry reports in the CollectorErrors counter of the collector.
+type ExecCollector struct {
+	name    string
+	command []string
+	format  string
+}
+
+// NewExecCollector creates a collector running a command.
+//
+// Parameters:
+//   - name: collector name, e.g. "exec/backup"
+//   - command: executable and its arguments; the command is not run through a shell
+//   - format: ScriptFormatText or ScriptFormatJSON; empty means ScriptFormatText
+//
+// Example usage:
+//
+//	c := metrics.NewExecCollector("exec/backup", []string{"/usr/local/bin/check_backup.sh"}, metrics.ScriptFormatText)
+func NewExecCollector(name string, command []string, format string) *ExecCollector {
+	if format == "" {
+		format = ScriptFormatText
+	}
+	return &ExecCollector{name: name, command: command, format: format}
+}
+
+// Name returns the collector name passed to NewExecCollector.
+func (c *ExecCollector) Name() string {
+	return c.name
+}
+
+// Collect runs the command and parses its output.
+func (c *ExecCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	if len(c.command) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.WaitDelay = scriptWaitDelay
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("run %s: %w", c.command[0], ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > maxScriptStderr {
+			msg = msg[:maxScriptStderr]
+		}
+		return nil, fmt.Errorf("run %s: %w: %s", c.command[0], err, msg)
+	}
+
+	if c.format == ScriptFormatJSON {
+		return parseJSONMetrics(stdout.Bytes())
+	}
+	return parseTextMetrics(stdout.String())
+}
+
+// parseTextMetrics parses metrics in the "name type value" line format.
+// Empty lines and lines starting with "#" are skipped. The name may contain
+// labels with spaces in their values, e.g. `Queue{name="a b"} gauge 1`.
+//
+// Returns an error for the first invalid line.
+func parseTextMetrics(text string) ([]models.Metric, error) {
+	var batch []models.Metric
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rest, value, ok := cutLastField(line)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"name type value\"", i+1)
+		}
+		name, mType, ok := cutLastField(rest)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"name type value\"", i+1)
+		}
+		m, err := models.CreateMetric(name, mType, value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		batch = append(batch, *m)
+	}
+	return batch, nil
+}
+
+// parseJSONMetrics parses a JSON array of metrics and checks that every metric
+// has a name, a known type and the value field of its type.
+func parseJSONMetrics(data []byte) ([]models.Metric, error) {
+	var batch []models.Metric
+	if err := json.Unmarshal(data, &batch); err != nil {
+		return nil, fmt.Errorf("parse json metrics: %w", err)
+	}
+	for i, m := range batch {
+		switch {
+		case m.ID == "":
+			return nil, fmt.Errorf("metric %d: empty id", i)
+		case m.MType == models.GaugeMetricName && m.Value == nil:
+			return nil, fmt.Errorf("metric %q: gauge without value", m.ID)
+		case m.MType == models.CounterMetricName && m.Delta == nil:
+			return nil, fmt.Errorf("metric %q: counter without delta", m.ID)
+		case m.MType != models.GaugeMetricName && m.MType != models.CounterMetricName:
+			return nil, fmt.Errorf("metric %q: invalid metric type %q", m.ID, m.MType)
+		}
+	}
+	return batch, nil
+}
+
+// cutLastField splits s at its last run of whitespace.
+func cutLastField(s string) (string, string, bool) {
+	i := strings.LastIndexAny(s, " \t")
+	if i < 0 {
+		return "", "", false
+	}
+	head := strings.TrimSpace(s[:i])
+	return head, s[i+1:], head != ""
+}
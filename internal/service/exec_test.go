@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTextMetrics(t *testing.T) {
+	batch, err := parseTextMetrics(`
+# backup checks
+BackupAge gauge 3600.5
+BackupFailures	counter	2
+Queue{name="mail out"} gauge 12
+`)
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, 3)
+	assert.Equal(t, 3600.5, *got["BackupAge"].Value)
+	assert.Equal(t, int64(2), *got["BackupFailures"].Delta)
+	assert.Equal(t, 12.0, *got[`Queue{name="mail out"}`].Value)
+
+	_, err = parseTextMetrics("BackupAge 1")
+	assert.ErrorContains(t, err, "line 1")
+	_, err = parseTextMetrics("ok\nBackupAge histogram 1")
+	assert.ErrorContains(t, err, "line 1")
+	_, err = parseTextMetrics("BackupAge counter 1.5")
+	assert.Error(t, err)
+}
+
+func TestParseJSONMetrics(t *testing.T) {
+	batch, err := parseJSONMetrics([]byte(`[{"id":"a","type":"gauge","value":1.5},{"id":"b","type":"counter","delta":3}]`))
+	require.NoError(t, err)
+	assert.Len(t, batch, 2)
+
+	for _, data := range []string{
+		`{"id":"a"}`,
+		`[{"type":"gauge","value":1}]`,
+		`[{"id":"a","type":"gauge"}]`,
+		`[{"id":"a","type":"counter","value":1}]`,
+		`[{"id":"a","type":"histogram","value":1}]`,
+	} {
+		_, err := parseJSONMetrics([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestExecCollector(t *testing.T) {
+	c := NewExecCollector("exec/echo", []string{"sh", "-c", "echo 'Answer gauge 42'"}, "")
+	assert.Equal(t, "exec/echo", c.Name())
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []models.Metric{{ID: "Answer", MType: models.GaugeMetricName, Value: ptr(42.0)}}, batch)
+
+	c = NewExecCollector("exec/fail", []string{"sh", "-c", "echo broken >&2; exit 3"}, "")
+	_, err = c.Collect(context.Background())
+	assert.ErrorContains(t, err, "broken")
+
+	c = NewExecCollector("exec/slow", []string{"sleep", "10"}, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = c.Collect(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,321 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// fingerprintSize is the number of leading bytes identifying a log file across restarts.
+const fingerprintSize = 256
+
+// LogPattern counts the log lines matching a regular expression.
+type LogPattern struct {
+	// Name is the value of the pattern label.
+	Name string
+
+	// Regexp is matched against every line without the line terminator.
+	Regexp *regexp.Regexp
+
+	// ValueGroup is the name of a capture group of Regexp holding a number.
+	// If set, the value of the last matching line is reported as a gauge.
+	ValueGroup string
+}
+
+// LogFile is a log file tailed by LogTailCollector.
+type LogFile struct {
+	// Path is the path to the log file.
+	Path string
+
+	// Patterns are matched against every new line of the file.
+	Patterns []LogPattern
+}
+
+// logOffset is the saved read position of a log file.
+type logOffset struct {
+	Offset int64 `json:"offset"`
+	// Fingerprint is a hash of the first FingerprintSize bytes of the file, at most
+	// fingerprintSize. It is used to detect files replaced while the agent was not
+	// running.
+	Fingerprint     string `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+}
+
+// logTail is the state of a tailed log file.
+type logTail struct {
+	file   *os.File
+	offset int64
+	// missing is set when the file did not exist at the time of a poll,
+	// so the file is read from the beginning once it appears.
+	missing bool
+}
+
+// LogTailCollector follows log files like "tail -F" and counts the lines matching patterns.
+//
+// Reported counters, labeled with file and pattern, as deltas since the previous poll:
+//   - LogMatches: number of new matching lines
+//
+// Reported gauges, labeled with file and pattern, for patterns with a ValueGroup:
+//   - LogLastValue: the number captured from the last matching line
+//
+// A file found at the first poll without a saved offset is read from its end;
+// files created or rotated later are read from the beginning. A rotated file is
+// read to its end before switching to the new file, and a truncated file is read
+// again from the beginning. Only complete lines are processed.
+//
+// If a state file is set, offsets are saved there after every poll and restored on
+// start, unless the file was replaced in the meantime. Offsets are saved before the
+// matches are delivered to the server, so delivery across restarts is at most once:
+// matches of lines read shortly before the agent stops, or kept in an unacknowledged
+// report, are not counted again after a restart.
+type LogTailCollector struct {
+	files     []LogFile
+	stateFile string
+	saved     map[string]logOffset
+	tails     map[string]*logTail
+}
+
+// NewLogTailCollector creates a collector named "logtail".
+//
+// Parameters:
+//   - files: log files to follow
+//   - stateFile: path to the JSON file with saved offsets; empty disables persistence
+//
+// Returns an error if the state file exists but cannot be read.
+func NewLogTailCollector(files []LogFile, stateFile string) (*LogTailCollector, error) {
+	c := &LogTailCollector{
+		files:     files,
+		stateFile: stateFile,
+		saved:     make(map[string]logOffset),
+		tails:     make(map[string]*logTail, len(files)),
+	}
+	for _, f := range files {
+		c.tails[f.Path] = &logTail{}
+	}
+	if stateFile == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read log offsets: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.saved); err != nil {
+		return nil, fmt.Errorf("parse log offsets %s: %w", stateFile, err)
+	}
+	return c, nil
+}
+
+// Name returns "logtail".
+func (c *LogTailCollector) Name() string {
+	return "logtail"
+}
+
+// Collect reads the new lines of all files. Files that do not exist yet are skipped.
+// Read errors are logged rather than returned, so the lines already counted in
+// other files are not lost.
+//
+// Once ctx is done Collect stops reading and returns the matches of the lines read
+// so far; the offsets are advanced past these lines only, so the rest is read by
+// the next call.
+func (c *LogTailCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	var batch []models.Metric
+	for _, lf := range c.files {
+		if ctx.Err() != nil {
+			break
+		}
+		matches := make([]int64, len(lf.Patterns))
+		values := make([]*float64, len(lf.Patterns))
+		err := c.tail(ctx, lf.Path, func(line []byte) {
+			for i, p := range lf.Patterns {
+				sub := p.Regexp.FindSubmatch(line)
+				if sub == nil {
+					continue
+				}
+				matches[i]++
+				if p.ValueGroup == "" {
+					continue
+				}
+				if idx := p.Regexp.SubexpIndex(p.ValueGroup); idx >= 0 {
+					if v, err := strconv.ParseFloat(string(sub[idx]), 64); err == nil {
+						values[i] = &v
+					}
+				}
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Tail %s failed: %v", lf.Path, err)
+		}
+
+		for i, p := range lf.Patterns {
+			labels := map[string]string{"file": lf.Path, "pattern": p.Name}
+			batch = append(batch, labeledCounter("LogMatches", labels, matches[i]))
+			if values[i] != nil {
+				batch = append(batch, labeledGauge("LogLastValue", labels, *values[i]))
+			}
+		}
+	}
+
+	if err := c.saveOffsets(); err != nil {
+		log.Printf("Collector %s: %v", c.Name(), err)
+	}
+	return batch, nil
+}
+
+// tail calls onLine for every new complete line of the file until ctx is done.
+func (c *LogTailCollector) tail(ctx context.Context, path string, onLine func([]byte)) error {
+	t := c.tails[path]
+	if t.file == nil {
+		f, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			t.missing = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.file = f
+		t.offset = c.startOffset(path, t)
+	}
+
+	// Read the rest of the open file first: after a rotation it is the old file.
+	if err := t.readLines(ctx, onLine); err != nil {
+		return err
+	}
+
+	current, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotated away and not recreated yet; keep the old file open.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	open, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	if os.SameFile(current, open) {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	t.file.Close()
+	t.file, t.offset = f, 0
+	return t.readLines(ctx, onLine)
+}
+
+// startOffset returns the offset a newly opened file is read from.
+func (c *LogTailCollector) startOffset(path string, t *logTail) int64 {
+	st, err := t.file.Stat()
+	if err != nil {
+		return 0
+	}
+	if saved, ok := c.saved[path]; ok {
+		if saved.Offset <= st.Size() && fileFingerprint(t.file, saved.FingerprintSize) == saved.Fingerprint {
+			return saved.Offset
+		}
+		return 0
+	}
+	if t.missing {
+		return 0
+	}
+	return st.Size()
+}
+
+// readLines reads the complete lines after the offset and advances the offset past them.
+// A file smaller than the offset was truncated and is read from the beginning.
+// It returns the error of ctx once it is done, leaving the offset after the last line read.
+func (t *logTail) readLines(ctx context.Context, onLine func([]byte)) error {
+	st, err := t.file.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() < t.offset {
+		t.offset = 0
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(t.file, t.offset, st.Size()-t.offset))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// An incomplete last line is read again on the next poll.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		t.offset += int64(len(line))
+		onLine(bytes.TrimRight(line, "\r\n"))
+	}
+}
+
+// saveOffsets writes the offsets of the open files to the state file.
+// The file is replaced atomically so a crash never leaves a partial state.
+func (c *LogTailCollector) saveOffsets() error {
+	if c.stateFile == "" {
+		return nil
+	}
+	for path, t := range c.tails {
+		if t.file == nil {
+			continue
+		}
+		size := min(t.offset, fingerprintSize)
+		c.saved[path] = logOffset{
+			Offset:          t.offset,
+			Fingerprint:     fileFingerprint(t.file, size),
+			FingerprintSize: size,
+		}
+	}
+
+	data, err := json.Marshal(c.saved)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.stateFile), filepath.Base(c.stateFile)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("save log offsets: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save log offsets: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save log offsets: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.stateFile); err != nil {
+		return fmt.Errorf("save log offsets: %w", err)
+	}
+	return nil
+}
+
+// fileFingerprint returns a hash of the first size bytes of the file.
+func fileFingerprint(f *os.File, size int64) string {
+	buf := make([]byte, size)
+	n, _ := f.ReadAt(buf, 0)
+	h := fnv.New64a()
+	h.Write(buf[:n])
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendFile(t *testing.T, path, text string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(text)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func collectLogs(t *testing.T, c *LogTailCollector) map[string]float64 {
+	t.Helper()
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := make(map[string]float64)
+	for _, m := range batch {
+		if m.Delta != nil {
+			got[m.ID] = float64(*m.Delta)
+		} else {
+			got[m.ID] = *m.Value
+		}
+	}
+	return got
+}
+
+func TestLogTailCollector(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	state := filepath.Join(dir, "offsets.json")
+	appendFile(t, path, "ERROR old line\n")
+
+	files := []LogFile{{Path: path, Patterns: []LogPattern{
+		{Name: "errors", Regexp: regexp.MustCompile(`ERROR`)},
+		{Name: "latency", Regexp: regexp.MustCompile(`latency=(?P<ms>[0-9.]+)`), ValueGroup: "ms"},
+	}}}
+	errorsID := `LogMatches{file="` + path + `",pattern="errors"}`
+	latencyID := `LogMatches{file="` + path + `",pattern="latency"}`
+	valueID := `LogLastValue{file="` + path + `",pattern="latency"}`
+
+	c, err := NewLogTailCollector(files, state)
+	require.NoError(t, err)
+	got := collectLogs(t, c)
+	assert.Equal(t, 0.0, got[errorsID], "existing lines are skipped")
+
+	appendFile(t, path, "ERROR one\nINFO latency=12.5\nINFO latency=7\nERROR partial")
+	got = collectLogs(t, c)
+	assert.Equal(t, 1.0, got[errorsID])
+	assert.Equal(t, 2.0, got[latencyID])
+	assert.Equal(t, 7.0, got[valueID])
+
+	appendFile(t, path, " line\n")
+	got = collectLogs(t, c)
+	assert.Equal(t, 1.0, got[errorsID], "partial line is counted once complete")
+	assert.NotContains(t, got, valueID)
+
+	// rotation: the old file gets one more line, then a new file is created
+	appendFile(t, path, "ERROR before rotation\n")
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "ERROR after rotation\n")
+	got = collectLogs(t, c)
+	assert.Equal(t, 2.0, got[errorsID])
+
+	// truncation
+	require.NoError(t, os.Truncate(path, 0))
+	appendFile(t, path, "ERROR\n")
+	got = collectLogs(t, c)
+	assert.Equal(t, 1.0, got[errorsID])
+
+	// restart resumes from the saved offset
+	appendFile(t, path, "ERROR while stopped\n")
+	c, err = NewLogTailCollector(files, state)
+	require.NoError(t, err)
+	got = collectLogs(t, c)
+	assert.Equal(t, 1.0, got[errorsID])
+
+	// a file replaced while stopped is read from the beginning
+	require.NoError(t, os.WriteFile(path, []byte("ERROR a\nERROR b\nERROR c\nERROR d\nERROR e\n"), 0644))
+	c, err = NewLogTailCollector(files, state)
+	require.NoError(t, err)
+	got = collectLogs(t, c)
+	assert.Equal(t, 5.0, got[errorsID])
+}
+
+func TestLogTailCollector_MissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "later.log")
+	c, err := NewLogTailCollector([]LogFile{{Path: path, Patterns: []LogPattern{
+		{Name: "any", Regexp: regexp.MustCompile(`.`)},
+	}}}, "")
+	require.NoError(t, err)
+	id := `LogMatches{file="` + path + `",pattern="any"}`
+
+	assert.Equal(t, 0.0, collectLogs(t, c)[id])
+	appendFile(t, path, "first\nsecond\n")
+	assert.Equal(t, 2.0, collectLogs(t, c)[id], "files created later are read from the beginning")
+}
+
+func TestLogTailCollector_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	state := filepath.Join(dir, "offsets.json")
+	appendFile(t, path, "")
+	files := []LogFile{{Path: path, Patterns: []LogPattern{{Name: "errors", Regexp: regexp.MustCompile(`ERROR`)}}}}
+	errorsID := `LogMatches{file="` + path + `",pattern="errors"}`
+
+	c, err := NewLogTailCollector(files, state)
+	require.NoError(t, err)
+	collectLogs(t, c)
+	appendFile(t, path, "ERROR one\nERROR two\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	batch, err := c.Collect(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, batch, "nothing is read once the context is done")
+
+	c, err = NewLogTailCollector(files, state)
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, collectLogs(t, c)[errorsID], "unread lines are read after a restart")
+}
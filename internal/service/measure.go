@@ -3,9 +3,11 @@
 package metrics
 
 import (
+	"context"
 	"math/rand"
 	"runtime"
 
+	"github.com/DenisPavlov/monitoring/internal/models"
 	"github.com/shirou/gopsutil/v4/load"
 	"github.com/shirou/gopsutil/v4/mem"
 )
@@ -67,7 +69,7 @@ func Gauge() map[string]float64 {
 }
 
 // AdditionalGauge collects and returns system-level metrics including
-// memory information and CPU utilization using the gopsutil library.
+// memory information and load average using the gopsutil library.
 //
 // This function provides insights into system-wide resource usage beyond
 // the Go runtime-specific metrics provided by Gauge().
@@ -78,7 +80,9 @@ func Gauge() map[string]float64 {
 // Collected metrics include:
 //   - TotalMemory: Total available system memory in bytes
 //   - FreeMemory: Free system memory in bytes
-//   - CPUutilization1: 1-minute load average (CPU utilization)
+//   - LoadAverage1: 1-minute load average
+//
+// CPU utilization per core is reported by CPUCollector.
 //
 // Note: Errors from underlying system calls are ignored and zero values
 // are returned for failed metrics.
@@ -87,16 +91,33 @@ func Gauge() map[string]float64 {
 //
 //	systemMetrics := metrics.AdditionalGauge()
 //	fmt.Printf("Total memory: %f bytes\n", systemMetrics["TotalMemory"])
-//	fmt.Printf("CPU load (1min): %f\n", systemMetrics["CPUutilization1"])
+//	fmt.Printf("CPU load (1min): %f\n", systemMetrics["LoadAverage1"])
 func AdditionalGauge() map[string]float64 {
-	memory, _ := mem.VirtualMemory()
-	avg, _ := load.Avg()
+	gauges, _ := systemGauges(context.Background())
+	return gauges
+}
 
-	return map[string]float64{
-		"TotalMemory":     float64(memory.Total),
-		"FreeMemory":      float64(memory.Free),
-		"CPUutilization1": avg.Load1,
+// systemGauges collects the AdditionalGauge metrics and returns the first error
+// of the underlying system calls. Failed metrics are reported as zero values.
+func systemGauges(ctx context.Context) (map[string]float64, error) {
+	memory, memErr := mem.VirtualMemoryWithContext(ctx)
+	if memory == nil {
+		memory = &mem.VirtualMemoryStat{}
+	}
+	avg, avgErr := load.AvgWithContext(ctx)
+	if avg == nil {
+		avg = &load.AvgStat{}
 	}
+
+	gauges := map[string]float64{
+		"TotalMemory":  float64(memory.Total),
+		"FreeMemory":   float64(memory.Free),
+		"LoadAverage1": avg.Load1,
+	}
+	if memErr != nil {
+		return gauges, memErr
+	}
+	return gauges, avgErr
 }
 
 // Count increments and returns counter metrics. Specifically, it increments
@@ -125,3 +146,75 @@ func Count(counters map[string]int64) map[string]int64 {
 	counters["PollCount"] = counters["PollCount"] + 1
 	return counters
 }
+
+// RuntimeCollector reports the Go runtime memory statistics returned by Gauge.
+type RuntimeCollector struct{}
+
+// NewRuntimeCollector creates a collector named "runtime".
+func NewRuntimeCollector() *RuntimeCollector {
+	return &RuntimeCollector{}
+}
+
+// Name returns "runtime".
+func (c *RuntimeCollector) Name() string {
+	return "runtime"
+}
+
+// Collect returns the Gauge metrics.
+func (c *RuntimeCollector) Collect(_ context.Context) ([]models.Metric, error) {
+	return gaugeBatch(Gauge()), nil
+}
+
+// SystemCollector reports the system memory and load metrics returned by AdditionalGauge.
+type SystemCollector struct{}
+
+// NewSystemCollector creates a collector named "system".
+func NewSystemCollector() *SystemCollector {
+	return &SystemCollector{}
+}
+
+// Name returns "system".
+func (c *SystemCollector) Name() string {
+	return "system"
+}
+
+// Collect returns the AdditionalGauge metrics or an error if a system call fails.
+func (c *SystemCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	gauges, err := systemGauges(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gaugeBatch(gauges), nil
+}
+
+// PollCountCollector reports the PollCount counter, incremented by one on every poll.
+type PollCountCollector struct{}
+
+// NewPollCountCollector creates a collector named "pollcount".
+func NewPollCountCollector() *PollCountCollector {
+	return &PollCountCollector{}
+}
+
+// Name returns "pollcount".
+func (c *PollCountCollector) Name() string {
+	return "pollcount"
+}
+
+// Collect returns a PollCount delta of one.
+func (c *PollCountCollector) Collect(_ context.Context) ([]models.Metric, error) {
+	delta := int64(1)
+	return []models.Metric{{ID: "PollCount", MType: models.CounterMetricName, Delta: &delta}}, nil
+}
+
+// gaugeBatch converts a map of gauge values into a metrics batch.
+func gaugeBatch(values map[string]float64) []models.Metric {
+	batch := make([]models.Metric, 0, len(values))
+	for name, value := range values {
+		batch = append(batch, models.Metric{
+			ID:    name,
+			MType: models.GaugeMetricName,
+			Value: &value,
+		})
+	}
+	return batch
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/shirou/gopsutil/v4/net"
+)
+
+// tcpStates lists the TCP connection states reported by NetworkCollector.
+// States without connections are reported as zero so stale values do not linger.
+var tcpStates = []string{
+	"ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+// NetworkCollector reports network interface statistics and TCP connection counts.
+//
+// Reported counters, labeled with interface, as deltas since the previous poll:
+//   - NetBytesSent, NetBytesRecv: transferred bytes
+//   - NetPacketsSent, NetPacketsRecv: transferred packets
+//   - NetErrIn, NetErrOut: receive and transmit errors
+//   - NetDropIn, NetDropOut: dropped packets
+//
+// Reported gauges:
+//   - TCPConnections{state="..."}: number of IPv4 and IPv6 TCP connections in the state
+//
+// The first Collect call only records the interface counters.
+type NetworkCollector struct {
+	interfaces Filter
+
+	ioCounters  func(ctx context.Context, pernic bool) ([]net.IOCountersStat, error)
+	connections func(ctx context.Context, kind string) ([]net.ConnectionStat, error)
+
+	prevIO map[string]net.IOCountersStat
+}
+
+// NewNetworkCollector creates a collector named "network".
+//
+// Parameters:
+//   - interfaces: selects interfaces by name, e.g. Exclude: ["lo", "veth*"]
+func NewNetworkCollector(interfaces Filter) *NetworkCollector {
+	return &NetworkCollector{
+		interfaces:  interfaces,
+		ioCounters:  net.IOCountersWithContext,
+		connections: net.ConnectionsWithoutUidsWithContext,
+	}
+}
+
+// Name returns "network".
+func (c *NetworkCollector) Name() string {
+	return "network"
+}
+
+// Collect returns the interface counter deltas since the previous call and the
+// current TCP connection counts.
+func (c *NetworkCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	counters, err := c.ioCounters(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("read network io counters: %w", err)
+	}
+	conns, err := c.connections(ctx, "tcp")
+	if err != nil {
+		return nil, fmt.Errorf("list tcp connections: %w", err)
+	}
+
+	states := make(map[string]int, len(tcpStates))
+	for _, conn := range conns {
+		states[conn.Status]++
+	}
+	batch := make([]models.Metric, 0, len(tcpStates)+8*len(counters))
+	for _, state := range tcpStates {
+		batch = append(batch, labeledGauge("TCPConnections", map[string]string{"state": state}, float64(states[state])))
+	}
+
+	prevIO := c.prevIO
+	c.prevIO = make(map[string]net.IOCountersStat, len(counters))
+	for _, cur := range counters {
+		if !matchFilter(c.interfaces, cur.Name) {
+			continue
+		}
+		c.prevIO[cur.Name] = cur
+		prev, ok := prevIO[cur.Name]
+		if !ok {
+			continue
+		}
+		labels := map[string]string{"interface": cur.Name}
+		batch = append(batch,
+			labeledCounter("NetBytesSent", labels, counterDelta(prev.BytesSent, cur.BytesSent)),
+			labeledCounter("NetBytesRecv", labels, counterDelta(prev.BytesRecv, cur.BytesRecv)),
+			labeledCounter("NetPacketsSent", labels, counterDelta(prev.PacketsSent, cur.PacketsSent)),
+			labeledCounter("NetPacketsRecv", labels, counterDelta(prev.PacketsRecv, cur.PacketsRecv)),
+			labeledCounter("NetErrIn", labels, counterDelta(prev.Errin, cur.Errin)),
+			labeledCounter("NetErrOut", labels, counterDelta(prev.Errout, cur.Errout)),
+			labeledCounter("NetDropIn", labels, counterDelta(prev.Dropin, cur.Dropin)),
+			labeledCounter("NetDropOut", labels, counterDelta(prev.Dropout, cur.Dropout)),
+		)
+	}
+	return batch, nil
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkCollector(t *testing.T) {
+	io := []net.IOCountersStat{
+		{Name: "eth0", BytesSent: 100, BytesRecv: 200, PacketsSent: 1, PacketsRecv: 2},
+		{Name: "lo", BytesSent: 100},
+		{Name: "veth12ab", BytesSent: 100},
+	}
+	c := NewNetworkCollector(Filter{Exclude: []string{"lo", "veth*"}})
+	c.ioCounters = func(context.Context, bool) ([]net.IOCountersStat, error) {
+		return io, nil
+	}
+	c.connections = func(context.Context, string) ([]net.ConnectionStat, error) {
+		return []net.ConnectionStat{{Status: "ESTABLISHED"}, {Status: "ESTABLISHED"}, {Status: "LISTEN"}}, nil
+	}
+
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, len(tcpStates))
+	assert.Equal(t, 2.0, *got[`TCPConnections{state="ESTABLISHED"}`].Value)
+	assert.Equal(t, 1.0, *got[`TCPConnections{state="LISTEN"}`].Value)
+	assert.Equal(t, 0.0, *got[`TCPConnections{state="TIME_WAIT"}`].Value)
+
+	io = []net.IOCountersStat{
+		{Name: "eth0", BytesSent: 150, BytesRecv: 260, PacketsSent: 3, PacketsRecv: 5, Dropin: 1},
+		{Name: "lo", BytesSent: 500},
+		{Name: "veth12ab", BytesSent: 500},
+	}
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.Len(t, got, len(tcpStates)+8)
+	assert.Equal(t, int64(50), *got[`NetBytesSent{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(60), *got[`NetBytesRecv{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(2), *got[`NetPacketsSent{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(3), *got[`NetPacketsRecv{interface="eth0"}`].Delta)
+	assert.Equal(t, int64(1), *got[`NetDropIn{interface="eth0"}`].Delta)
+	assert.NotContains(t, got, `NetBytesSent{interface="lo"}`)
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// DefaultProbeTimeout limits a probe without its own timeout.
+const DefaultProbeTimeout = 5 * time.Second
+
+// Probe describes a synthetic check of a network service.
+// Exactly one of URL and Address is set.
+type Probe struct {
+	// Name is the value of the probe label.
+	Name string
+
+	// URL is probed with an HTTP GET request. Redirects are followed.
+	URL string
+
+	// Address is probed by opening a TCP connection, e.g. "localhost:5432".
+	Address string
+
+	// Timeout limits the probe. Zero means DefaultProbeTimeout.
+	Timeout time.Duration
+}
+
+// ProbeCollector runs HTTP and TCP probes concurrently.
+//
+// Reported gauges, labeled with probe:
+//   - ProbeSuccess: 1 if the service responded (HTTP status below 400), 0 otherwise
+//   - ProbeDurationSeconds: time taken by the probe
+//   - ProbeHTTPStatusCode: final HTTP status code, 0 without response (HTTP only)
+//   - ProbeHTTPContentLength: size of the response body in bytes (HTTP only)
+//   - ProbeTLSCertExpiry: expiry time of the earliest expiring server certificate
+//     in seconds since the epoch (HTTPS only)
+//
+// Failed probes are reported as metrics, never as a collector error.
+type ProbeCollector struct {
+	probes []Probe
+	client *http.Client
+	dialer *net.Dialer
+}
+
+// NewProbeCollector creates a collector named "probe".
+func NewProbeCollector(probes []Probe) *ProbeCollector {
+	return &ProbeCollector{
+		probes: probes,
+		client: &http.Client{},
+		dialer: &net.Dialer{},
+	}
+}
+
+// Name returns "probe".
+func (c *ProbeCollector) Name() string {
+	return "probe"
+}
+
+// Collect runs all probes and waits for them to finish.
+func (c *ProbeCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	results := make([][]models.Metric, len(c.probes))
+	var wg sync.WaitGroup
+	for i, p := range c.probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			timeout := p.Timeout
+			if timeout <= 0 {
+				timeout = DefaultProbeTimeout
+			}
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			if p.URL != "" {
+				results[i] = c.probeHTTP(probeCtx, p)
+			} else {
+				results[i] = c.probeTCP(probeCtx, p)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var batch []models.Metric
+	for _, res := range results {
+		batch = append(batch, res...)
+	}
+	return batch, nil
+}
+
+// probeHTTP sends a GET request to the probe URL and reads the whole response.
+func (c *ProbeCollector) probeHTTP(ctx context.Context, p Probe) []models.Metric {
+	labels := map[string]string{"probe": p.Name}
+	start := time.Now()
+	var (
+		success, status, size float64
+		certExpiry            *time.Time
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = c.client.Do(req); err == nil {
+			n, readErr := io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			status, size = float64(resp.StatusCode), float64(n)
+			if readErr == nil && resp.StatusCode < http.StatusBadRequest {
+				success = 1
+			}
+			certExpiry = earliestCertExpiry(resp.TLS)
+		}
+	}
+
+	batch := []models.Metric{
+		labeledGauge("ProbeSuccess", labels, success),
+		labeledGauge("ProbeDurationSeconds", labels, time.Since(start).Seconds()),
+		labeledGauge("ProbeHTTPStatusCode", labels, status),
+		labeledGauge("ProbeHTTPContentLength", labels, size),
+	}
+	if certExpiry != nil {
+		batch = append(batch, labeledGauge("ProbeTLSCertExpiry", labels, float64(certExpiry.Unix())))
+	}
+	return batch
+}
+
+// probeTCP opens and closes a TCP connection to the probe address.
+func (c *ProbeCollector) probeTCP(ctx context.Context, p Probe) []models.Metric {
+	labels := map[string]string{"probe": p.Name}
+	start := time.Now()
+	success := 0.0
+	conn, err := c.dialer.DialContext(ctx, "tcp", p.Address)
+	if err == nil {
+		conn.Close()
+		success = 1
+	}
+	return []models.Metric{
+		labeledGauge("ProbeSuccess", labels, success),
+		labeledGauge("ProbeDurationSeconds", labels, time.Since(start).Seconds()),
+	}
+}
+
+// earliestCertExpiry returns the earliest expiry time of the server certificates,
+// or nil for plain HTTP.
+func earliestCertExpiry(state *tls.ConnectionState) *time.Time {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	earliest := state.PeerCertificates[0].NotAfter
+	for _, cert := range state.PeerCertificates[1:] {
+		if cert.NotAfter.Before(earliest) {
+			earliest = cert.NotAfter
+		}
+	}
+	return &earliest
+}
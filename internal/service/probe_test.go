@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeCollector(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	})
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddr := closed.Addr().String()
+	require.NoError(t, closed.Close())
+
+	c := NewProbeCollector([]Probe{
+		{Name: "ok", URL: srv.URL + "/ok"},
+		{Name: "fail", URL: srv.URL + "/fail"},
+		{Name: "slow", URL: srv.URL + "/slow", Timeout: 50 * time.Millisecond},
+		{Name: "tcp", Address: srv.Listener.Addr().String()},
+		{Name: "closed", Address: closedAddr},
+	})
+	c.client = srv.Client()
+
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+
+	assert.Equal(t, 1.0, *got[`ProbeSuccess{probe="ok"}`].Value)
+	assert.Equal(t, 200.0, *got[`ProbeHTTPStatusCode{probe="ok"}`].Value)
+	assert.Equal(t, 5.0, *got[`ProbeHTTPContentLength{probe="ok"}`].Value)
+	assert.Greater(t, *got[`ProbeDurationSeconds{probe="ok"}`].Value, 0.0)
+	expiry := srv.Certificate().NotAfter.Unix()
+	assert.Equal(t, float64(expiry), *got[`ProbeTLSCertExpiry{probe="ok"}`].Value)
+
+	assert.Equal(t, 0.0, *got[`ProbeSuccess{probe="fail"}`].Value)
+	assert.Equal(t, 503.0, *got[`ProbeHTTPStatusCode{probe="fail"}`].Value)
+
+	assert.Equal(t, 0.0, *got[`ProbeSuccess{probe="slow"}`].Value)
+	assert.Equal(t, 0.0, *got[`ProbeHTTPStatusCode{probe="slow"}`].Value)
+	assert.Less(t, *got[`ProbeDurationSeconds{probe="slow"}`].Value, 0.5)
+	assert.NotContains(t, got, `ProbeTLSCertExpiry{probe="slow"}`)
+
+	assert.Equal(t, 1.0, *got[`ProbeSuccess{probe="tcp"}`].Value)
+	assert.Equal(t, 0.0, *got[`ProbeSuccess{probe="closed"}`].Value)
+	assert.NotContains(t, got, `ProbeHTTPStatusCode{probe="tcp"}`)
+}
@@ -0,0 +1,257 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// ProcessGroup selects the processes aggregated under one group name.
+//
+// A process belongs to the group if its PID is read from Pidfile, or if it
+// matches all configured regular expressions. A group without regular
+// expressions only matches the pidfile process.
+type ProcessGroup struct {
+	// Name is the value of the group label.
+	Name string
+
+	// NameRegexp matches the process name (the executable name, e.g. "nginx").
+	NameRegexp *regexp.Regexp
+
+	// CmdlineRegexp matches the full command line joined with spaces.
+	CmdlineRegexp *regexp.Regexp
+
+	// Pidfile is the path to a file with the PID of the process.
+	Pidfile string
+}
+
+// hasRegexp reports whether the group matches processes by regular expressions.
+func (g ProcessGroup) hasRegexp() bool {
+	return g.NameRegexp != nil || g.CmdlineRegexp != nil
+}
+
+// processIdentity holds the process attributes used for matching.
+type processIdentity struct {
+	name    string
+	cmdline string
+}
+
+// processStats holds a sample of the process resource usage.
+type processStats struct {
+	// createTime is the process start time in milliseconds since the epoch.
+	createTime int64
+	// cpuSeconds is the user and system CPU time consumed by the process.
+	cpuSeconds float64
+	rss        uint64
+	fds        int32
+	threads    int32
+}
+
+// cpuSample is the CPU time of a process at the time of the previous poll.
+type cpuSample struct {
+	createTime int64
+	cpuSeconds float64
+	at         time.Time
+}
+
+// ProcessCollector reports resource usage of process groups.
+//
+// Reported gauges, labeled with group:
+//   - ProcessCount: number of matched processes
+//   - ProcessCPUPercent: CPU usage since the previous poll, 100 per fully used core
+//   - ProcessRSS: resident memory in bytes
+//   - ProcessOpenFDs: open file descriptors
+//   - ProcessThreads: number of threads
+//   - ProcessUptime: uptime of the oldest process in seconds
+//
+// Values are summed over the processes of the group. A process contributes to
+// ProcessCPUPercent from its second poll on. Groups without processes report zeros.
+type ProcessCollector struct {
+	groups []ProcessGroup
+
+	pids     func(ctx context.Context) ([]int32, error)
+	identity func(ctx context.Context, pid int32) (processIdentity, error)
+	stats    func(ctx context.Context, pid int32) (processStats, error)
+	now      func() time.Time
+
+	prevCPU map[int32]cpuSample
+}
+
+// NewProcessCollector creates a collector named "process".
+//
+// Parameters:
+//   - groups: process groups to report; group names must be unique
+func NewProcessCollector(groups []ProcessGroup) *ProcessCollector {
+	return &ProcessCollector{
+		groups:   groups,
+		pids:     process.PidsWithContext,
+		identity: readProcessIdentity,
+		stats:    readProcessStats,
+		now:      time.Now,
+	}
+}
+
+// Name returns "process".
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+// Collect returns the current metrics of every process group. Processes that exit
+// during the collection are skipped.
+func (c *ProcessCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	var pids []int32
+	for _, g := range c.groups {
+		if g.hasRegexp() {
+			var err error
+			if pids, err = c.pids(ctx); err != nil {
+				return nil, fmt.Errorf("list processes: %w", err)
+			}
+			break
+		}
+	}
+
+	now := c.now()
+	identities := make(map[int32]processIdentity)
+	prevCPU := c.prevCPU
+	c.prevCPU = make(map[int32]cpuSample)
+
+	batch := make([]models.Metric, 0, 6*len(c.groups))
+	for _, g := range c.groups {
+		var (
+			count, fds, threads int64
+			rss                 uint64
+			cpuPercent, uptime  float64
+		)
+		for _, pid := range c.match(ctx, g, pids, identities) {
+			st, err := c.stats(ctx, pid)
+			if err != nil {
+				continue
+			}
+			count++
+			rss += st.rss
+			fds += int64(st.fds)
+			threads += int64(st.threads)
+			uptime = max(uptime, now.Sub(time.UnixMilli(st.createTime)).Seconds())
+
+			if prev, ok := prevCPU[pid]; ok && prev.createTime == st.createTime {
+				if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+					cpuPercent += max(0, st.cpuSeconds-prev.cpuSeconds) / elapsed * 100
+				}
+			}
+			c.prevCPU[pid] = cpuSample{createTime: st.createTime, cpuSeconds: st.cpuSeconds, at: now}
+		}
+
+		labels := map[string]string{"group": g.Name}
+		batch = append(batch,
+			labeledGauge("ProcessCount", labels, float64(count)),
+			labeledGauge("ProcessCPUPercent", labels, cpuPercent),
+			labeledGauge("ProcessRSS", labels, float64(rss)),
+			labeledGauge("ProcessOpenFDs", labels, float64(fds)),
+			labeledGauge("ProcessThreads", labels, float64(threads)),
+			labeledGauge("ProcessUptime", labels, uptime),
+		)
+	}
+	return batch, nil
+}
+
+// match returns the PIDs of the processes belonging to the group.
+// identities caches the process names and command lines for a single poll.
+func (c *ProcessCollector) match(ctx context.Context, g ProcessGroup, pids []int32, identities map[int32]processIdentity) []int32 {
+	var matched []int32
+	if g.Pidfile != "" {
+		if pid, err := readPidfile(g.Pidfile); err == nil {
+			matched = append(matched, pid)
+		}
+	}
+	if !g.hasRegexp() {
+		return matched
+	}
+
+	for _, pid := range pids {
+		id, ok := identities[pid]
+		if !ok {
+			var err error
+			if id, err = c.identity(ctx, pid); err != nil {
+				continue
+			}
+			identities[pid] = id
+		}
+		if g.NameRegexp != nil && !g.NameRegexp.MatchString(id.name) {
+			continue
+		}
+		if g.CmdlineRegexp != nil && !g.CmdlineRegexp.MatchString(id.cmdline) {
+			continue
+		}
+		if len(matched) == 0 || matched[0] != pid {
+			matched = append(matched, pid)
+		}
+	}
+	return matched
+}
+
+// readPidfile reads the PID from the first line of a pidfile.
+func readPidfile(path string) (int32, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	pid, err := strconv.ParseInt(strings.TrimSpace(line), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid pidfile %s: %w", path, err)
+	}
+	return int32(pid), nil
+}
+
+func readProcessIdentity(ctx context.Context, pid int32) (processIdentity, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return processIdentity{}, err
+	}
+	name, err := p.NameWithContext(ctx)
+	if err != nil {
+		return processIdentity{}, err
+	}
+	// Kernel threads have no command line; an error here is not fatal for matching by name.
+	cmdline, _ := p.CmdlineWithContext(ctx)
+	return processIdentity{name: name, cmdline: cmdline}, nil
+}
+
+func readProcessStats(ctx context.Context, pid int32) (processStats, error) {
+	p, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return processStats{}, err
+	}
+	createTime, err := p.CreateTimeWithContext(ctx)
+	if err != nil {
+		return processStats{}, err
+	}
+	times, err := p.TimesWithContext(ctx)
+	if err != nil {
+		return processStats{}, err
+	}
+	memory, err := p.MemoryInfoWithContext(ctx)
+	if err != nil {
+		return processStats{}, err
+	}
+	threads, err := p.NumThreadsWithContext(ctx)
+	if err != nil {
+		return processStats{}, err
+	}
+	// Open descriptors of processes owned by other users cannot be read without privileges.
+	fds, _ := p.NumFDsWithContext(ctx)
+	return processStats{
+		createTime: createTime,
+		cpuSeconds: times.User + times.System,
+		rss:        memory.RSS,
+		fds:        fds,
+		threads:    threads,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessCollector(t *testing.T) {
+	pidfile := filepath.Join(t.TempDir(), "server.pid")
+	require.NoError(t, os.WriteFile(pidfile, []byte("30\n"), 0600))
+
+	start := time.Unix(1000, 0)
+	now := start
+	identities := map[int32]processIdentity{
+		10: {name: "postgres", cmdline: "postgres -D /data"},
+		11: {name: "postgres", cmdline: "postgres: checkpointer"},
+		20: {name: "bash", cmdline: "bash"},
+		30: {name: "server", cmdline: "./server -a :8080"},
+	}
+	stats := map[int32]processStats{
+		10: {createTime: start.Add(-time.Hour).UnixMilli(), cpuSeconds: 10, rss: 100, fds: 5, threads: 2},
+		11: {createTime: start.Add(-time.Minute).UnixMilli(), cpuSeconds: 1, rss: 50, fds: 3, threads: 1},
+		30: {createTime: start.UnixMilli(), cpuSeconds: 0, rss: 10, fds: 1, threads: 8},
+	}
+
+	c := NewProcessCollector([]ProcessGroup{
+		{Name: "postgres", NameRegexp: regexp.MustCompile("^postgres$")},
+		{Name: "server", Pidfile: pidfile},
+		{Name: "missing", CmdlineRegexp: regexp.MustCompile("nginx")},
+	})
+	c.now = func() time.Time { return now }
+	c.pids = func(context.Context) ([]int32, error) { return []int32{10, 11, 20, 30}, nil }
+	c.identity = func(_ context.Context, pid int32) (processIdentity, error) { return identities[pid], nil }
+	c.stats = func(_ context.Context, pid int32) (processStats, error) {
+		st, ok := stats[pid]
+		if !ok {
+			return processStats{}, errors.New("no such process")
+		}
+		return st, nil
+	}
+
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, 18)
+	assert.Equal(t, 2.0, *got[`ProcessCount{group="postgres"}`].Value)
+	assert.Equal(t, 150.0, *got[`ProcessRSS{group="postgres"}`].Value)
+	assert.Equal(t, 8.0, *got[`ProcessOpenFDs{group="postgres"}`].Value)
+	assert.Equal(t, 3.0, *got[`ProcessThreads{group="postgres"}`].Value)
+	assert.Equal(t, 3600.0, *got[`ProcessUptime{group="postgres"}`].Value)
+	assert.Equal(t, 0.0, *got[`ProcessCPUPercent{group="postgres"}`].Value)
+	assert.Equal(t, 1.0, *got[`ProcessCount{group="server"}`].Value)
+	assert.Equal(t, 8.0, *got[`ProcessThreads{group="server"}`].Value)
+	assert.Equal(t, 0.0, *got[`ProcessCount{group="missing"}`].Value)
+
+	now = now.Add(10 * time.Second)
+	stats[10] = processStats{createTime: stats[10].createTime, cpuSeconds: 15}
+	// process 11 was restarted with the same PID
+	stats[11] = processStats{createTime: now.UnixMilli(), cpuSeconds: 100}
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.InDelta(t, 50.0, *got[`ProcessCPUPercent{group="postgres"}`].Value, 1e-9)
+}
+
+func TestReadPidfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.pid")
+	require.NoError(t, os.WriteFile(path, []byte(" 42 \n"), 0600))
+	pid, err := readPidfile(path)
+	require.NoError(t, err)
+	assert.Equal(t, int32(42), pid)
+
+	require.NoError(t, os.WriteFile(path, []byte("abc"), 0600))
+	_, err = readPidfile(path)
+	assert.Error(t, err)
+}
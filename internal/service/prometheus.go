@@ -0,0 +1,193 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// Prometheus metric types as written in "# TYPE" lines.
+const (
+	promCounter   = "counter"
+	promGauge     = "gauge"
+	promUntyped   = "untyped"
+	promHistogram = "histogram"
+	promSummary   = "summary"
+)
+
+// promSample is a single sample of the Prometheus text exposition format.
+type promSample struct {
+	name   string
+	labels map[string]string
+	// typ is the type of the metric family the sample belongs to.
+	typ   string
+	value float64
+}
+
+// id returns the metric ID of the sample with the labels folded in.
+func (s promSample) id() string {
+	return models.WithLabels(s.name, s.labels)
+}
+
+// parsePrometheusText parses the Prometheus text exposition format.
+//
+// Samples without a "# TYPE" line are untyped. Timestamps are ignored.
+// Returns an error for the first malformed line.
+//
+// Example input:
+//
+//	# TYPE http_requests_total counter
+//	http_requests_total{method="post",code="200"} 1027 1395066363000
+//	temperature 21.5
+func parsePrometheusText(text string) ([]promSample, error) {
+	types := make(map[string]string)
+	var samples []promSample
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		s, err := parsePromSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		s.typ = promSampleType(types, s.name)
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// promSampleType returns the family type of a sample. Histogram and summary
+// samples are named after the family with a _bucket, _sum or _count suffix.
+func promSampleType(types map[string]string, name string) string {
+	if typ, ok := types[name]; ok {
+		return typ
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			if typ := types[base]; typ == promHistogram || typ == promSummary {
+				return typ
+			}
+		}
+	}
+	return promUntyped
+}
+
+// parsePromSample parses a `name{label="value",...} value [timestamp]` line.
+func parsePromSample(line string) (promSample, error) {
+	var s promSample
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("invalid sample %q", line)
+	}
+	s.name, line = line[:end], line[end:]
+
+	if strings.HasPrefix(line, "{") {
+		labels, rest, err := parsePromLabels(line[1:])
+		if err != nil {
+			return s, err
+		}
+		s.labels, line = labels, rest
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, fmt.Errorf("invalid value of %s", s.name)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value of %s: %w", s.name, err)
+	}
+	s.value = value
+	return s, nil
+}
+
+// parsePromLabels parses the label set after the opening brace and returns
+// the rest of the line after the closing brace.
+func parsePromLabels(line string) (map[string]string, string, error) {
+	labels := make(map[string]string)
+	for {
+		line = strings.TrimLeft(line, " \t")
+		if strings.HasPrefix(line, "}") {
+			return labels, line[1:], nil
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || len(line) < eq+2 || line[eq+1] != '"' {
+			return nil, "", fmt.Errorf("invalid labels")
+		}
+		name := strings.TrimSpace(line[:eq])
+		line = line[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(line); i++ {
+			ch := line[i]
+			if ch == '\\' && i+1 < len(line) {
+				i++
+				if line[i] == 'n' {
+					value.WriteByte('\n')
+				} else {
+					value.WriteByte(line[i])
+				}
+				continue
+			}
+			if ch == '"' {
+				line = line[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(ch)
+		}
+		if !closed {
+			return nil, "", fmt.Errorf("unterminated value of label %s", name)
+		}
+		labels[name] = value.String()
+		line = strings.TrimPrefix(strings.TrimLeft(line, " \t"), ",")
+	}
+}
+
+// convertPromSamples converts samples into agent metrics.
+//
+// Gauges and untyped samples are reported as gauges. Counters are cumulative in
+// the Prometheus model and are reported as the increase since the value stored
+// in prev; a counter seen for the first time only records its value, and a
+// counter that went backwards was reset, so its current value is the increase.
+// Histograms, summaries and non-finite values are skipped.
+//
+// The current counter values are stored in next, which replaces prev on the next call.
+func convertPromSamples(samples []promSample, prev, next map[string]float64) []models.Metric {
+	batch := make([]models.Metric, 0, len(samples))
+	for _, s := range samples {
+		if math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+			continue
+		}
+		switch s.typ {
+		case promGauge, promUntyped:
+			batch = append(batch, labeledGauge(s.name, s.labels, s.value))
+		case promCounter:
+			id := s.id()
+			next[id] = s.value
+			p, ok := prev[id]
+			if !ok {
+				continue
+			}
+			delta := math.Floor(s.value) - math.Floor(p)
+			if s.value < p {
+				delta = math.Floor(s.value)
+			}
+			batch = append(batch, labeledCounter(s.name, s.labels, int64(delta)))
+		}
+	}
+	return batch
+}
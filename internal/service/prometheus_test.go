@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePrometheusText(t *testing.T) {
+	samples, err := parsePrometheusText(`
+# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post", code="400"} 3
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.5"} 4773
+rpc_duration_seconds_sum 1.7560473e+07
+rpc_duration_seconds_count 2693
+msg{text="a \"quoted\" \\ value,}"} +Inf
+temperature 21.5
+`)
+	require.NoError(t, err)
+	require.Len(t, samples, 7)
+
+	assert.Equal(t, `http_requests_total{code="200",method="post"}`, samples[0].id())
+	assert.Equal(t, promCounter, samples[0].typ)
+	assert.Equal(t, 1027.0, samples[0].value)
+	assert.Equal(t, `http_requests_total{code="400",method="post"}`, samples[1].id())
+	assert.Equal(t, promSummary, samples[2].typ)
+	assert.Equal(t, promSummary, samples[3].typ)
+	assert.Equal(t, promSummary, samples[4].typ)
+	assert.Equal(t, `a "quoted" \ value,}`, samples[5].labels["text"])
+	assert.True(t, math.IsInf(samples[5].value, 1))
+	assert.Equal(t, promUntyped, samples[6].typ)
+	assert.Equal(t, "temperature", samples[6].id())
+
+	for _, text := range []string{"temperature", "temperature abc", `t{a="b} 1`, `t{a=b} 1`, "t 1 2 3"} {
+		_, err := parsePrometheusText(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestConvertPromSamples(t *testing.T) {
+	samples := []promSample{
+		{name: "requests_total", typ: promCounter, value: 10.5},
+		{name: "temperature", typ: promUntyped, value: 21.5},
+		{name: "rpc_seconds_count", typ: promSummary, value: 3},
+		{name: "load", typ: promGauge, value: math.NaN()},
+	}
+	prev := make(map[string]float64)
+	next := make(map[string]float64)
+	batch := convertPromSamples(samples, prev, next)
+	assert.Len(t, batch, 1)
+	assert.Equal(t, 21.5, *batch[0].Value)
+
+	samples[0].value = 12.2
+	prev, next = next, make(map[string]float64)
+	batch = convertPromSamples(samples, prev, next)
+	got := metricsByID(batch)
+	assert.Equal(t, int64(2), *got["requests_total"].Delta)
+
+	samples[0].value = 4
+	prev, next = next, make(map[string]float64)
+	batch = convertPromSamples(samples, prev, next)
+	assert.Equal(t, int64(4), *metricsByID(batch)["requests_total"].Delta)
+}
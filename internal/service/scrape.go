@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// maxScrapeBodySize limits the size of a scraped response.
+const maxScrapeBodySize = 16 << 20
+
+// ScrapeCollector reads metrics from an HTTP endpoint in the Prometheus text
+// exposition format, e.g. the /metrics endpoint of a local service.
+//
+// Gauges and untyped metrics are reported as gauges, counters as deltas between
+// scrapes with reset detection (see convertPromSamples). Every metric is labeled
+// with target unless it already has that label.
+type ScrapeCollector struct {
+	name   string
+	target string
+	url    string
+	client *http.Client
+	prev   map[string]float64
+}
+
+// NewScrapeCollector creates a collector scraping a single endpoint.
+//
+// Parameters:
+//   - name: collector name, e.g. "scrape/node"
+//   - target: value of the target label
+//   - url: endpoint URL, e.g. "http://localhost:9100/metrics"
+//
+// Example usage:
+//
+//	c := metrics.NewScrapeCollector("scrape/node", "node", "http://localhost:9100/metrics")
+func NewScrapeCollector(name, target, url string) *ScrapeCollector {
+	return &ScrapeCollector{name: name, target: target, url: url, client: http.DefaultClient}
+}
+
+// Name returns the collector name passed to NewScrapeCollector.
+func (c *ScrapeCollector) Name() string {
+	return c.name
+}
+
+// Collect scrapes the endpoint. Non-200 responses and malformed bodies are errors.
+func (c *ScrapeCollector) Collect(ctx context.Context) ([]models.Metric, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scrape %s: %w", c.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scrape %s: unexpected status %s", c.url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScrapeBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("scrape %s: %w", c.url, err)
+	}
+
+	samples, err := parsePrometheusText(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("scrape %s: %w", c.url, err)
+	}
+	next := make(map[string]float64)
+	batch := convertPromSamples(samples, c.prev, next)
+	c.prev = next
+
+	labels := map[string]string{"target": c.target}
+	for i := range batch {
+		batch[i].ID = models.AddLabels(batch[i].ID, labels)
+	}
+	return batch, nil
+}
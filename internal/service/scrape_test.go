@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScrapeCollector(t *testing.T) {
+	requests := 0.0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		requests += 10
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte("# TYPE http_requests_total counter\n" +
+			"http_requests_total{code=\"200\"} " + formatFloat(requests) + "\n" +
+			"# TYPE goroutines gauge\ngoroutines 12\n"))
+	}))
+	defer srv.Close()
+
+	c := NewScrapeCollector("scrape/app", "app", srv.URL+"/metrics")
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, 1)
+	assert.Equal(t, 12.0, *got[`goroutines{target="app"}`].Value)
+
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.Equal(t, int64(10), *got[`http_requests_total{code="200",target="app"}`].Delta)
+
+	_, err = NewScrapeCollector("scrape/missing", "missing", srv.URL+"/missing").Collect(context.Background())
+	assert.ErrorContains(t, err, "unexpected status")
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
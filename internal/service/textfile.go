@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// TextfileCollector reports metrics left by other programs in a directory.
+//
+// Files named *.prom hold the Prometheus text exposition format and files named
+// *.json hold a JSON array of models.Metric. The counters differ as in their origin
+// formats:
+//   - *.prom counters are cumulative totals and are reported as deltas between polls
+//     (see convertPromSamples)
+//   - *.json counter deltas are increments, as in the server API and the json output
+//     of ExecCollector; they are reported once every time the file is rewritten, i.e.
+//     its modification time or size changes
+//
+// Both are tracked per file, so equal metric IDs in different files do not interfere.
+// Files present at the first poll only record their state, so restarting the agent
+// does not report their counters again.
+//
+// Writers must create the file under another name (e.g. a hidden ".job.prom.tmp")
+// and rename it into place, so the collector never sees a partially written file.
+// Hidden files are ignored, and a file that changes while it is read is skipped
+// until the next poll.
+//
+// Reported gauges for every file, labeled with file:
+//   - TextfileMtime: file modification time in seconds since the epoch, for staleness alerts
+//   - TextfileError: 1 if the file could not be parsed, 0 otherwise
+type TextfileCollector struct {
+	dir string
+	// prev holds the cumulative counters of every file, by file name and metric ID.
+	prev map[string]map[string]float64
+	// versions holds the state of every file at the previous poll, by file name.
+	versions map[string]os.FileInfo
+}
+
+// NewTextfileCollector creates a collector named "textfile" reading the directory dir.
+// An empty dir disables the collector.
+func NewTextfileCollector(dir string) *TextfileCollector {
+	return &TextfileCollector{dir: dir}
+}
+
+// Name returns "textfile".
+func (c *TextfileCollector) Name() string {
+	return "textfile"
+}
+
+// Collect reads all metric files of the directory. Invalid files are reported in
+// TextfileError; an error is returned only if the directory cannot be read.
+func (c *TextfileCollector) Collect(_ context.Context) ([]models.Metric, error) {
+	if c.dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read textfile directory: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.IsDir() || strings.HasPrefix(name, ".") || (ext != ".prom" && ext != ".json") {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	first := c.versions == nil
+	next := make(map[string]map[string]float64, len(names))
+	versions := make(map[string]os.FileInfo, len(names))
+	var batch []models.Metric
+	for _, name := range names {
+		samples, info, err := readTextfile(filepath.Join(c.dir, name))
+		if err != nil {
+			log.Printf("Textfile %s skipped: %v", name, err)
+		}
+		if info == nil {
+			if prev, ok := c.versions[name]; ok {
+				versions[name], next[name] = prev, c.prev[name]
+			}
+			continue
+		}
+		prev, seen := c.versions[name]
+		versions[name] = info
+		rewritten := !first && (!seen || !os.SameFile(prev, info) ||
+			!prev.ModTime().Equal(info.ModTime()) || prev.Size() != info.Size())
+
+		labels := map[string]string{"file": name}
+		failed := 0.0
+		if err != nil {
+			failed = 1
+		}
+		batch = append(batch,
+			labeledGauge("TextfileMtime", labels, float64(info.ModTime().Unix())),
+			labeledGauge("TextfileError", labels, failed),
+		)
+
+		next[name] = make(map[string]float64)
+		batch = append(batch, convertPromSamples(samples, c.prev[name], next[name])...)
+		for _, s := range samples {
+			if s.typ == jsonIncrement && rewritten {
+				batch = append(batch, labeledCounter(s.name, s.labels, int64(s.value)))
+			}
+		}
+	}
+	c.prev, c.versions = next, versions
+	return batch, nil
+}
+
+// jsonIncrement is the sample type of the counters of *.json files, which hold
+// increments rather than cumulative totals.
+const jsonIncrement = "increment"
+
+// readTextfile reads and parses a metric file. It returns the file state, or nil
+// if the file vanished or changed while it was read.
+func readTextfile(path string) ([]promSample, os.FileInfo, error) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !os.SameFile(before, after) || before.ModTime() != after.ModTime() || before.Size() != after.Size() {
+		return nil, nil, fmt.Errorf("file changed while reading")
+	}
+
+	if filepath.Ext(path) == ".json" {
+		batch, err := parseJSONMetrics(data)
+		if err != nil {
+			return nil, after, err
+		}
+		samples := make([]promSample, 0, len(batch))
+		for _, m := range batch {
+			name, labels := models.SplitLabels(m.ID)
+			s := promSample{name: name, labels: labels, typ: promGauge}
+			if m.MType == models.CounterMetricName {
+				s.typ, s.value = jsonIncrement, float64(*m.Delta)
+			} else {
+				s.value = *m.Value
+			}
+			samples = append(samples, s)
+		}
+		return samples, after, nil
+	}
+
+	samples, err := parsePrometheusText(string(data))
+	if err != nil {
+		return nil, after, err
+	}
+	return samples, after, nil
+}
@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextfileCollector(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		tmp := filepath.Join(dir, ".tmp")
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0644))
+		require.NoError(t, os.Rename(tmp, filepath.Join(dir, name)))
+	}
+	write("backup.prom", "# TYPE backup_runs_total counter\nbackup_runs_total 5\nbackup_size_bytes 1024\n")
+	write("queue.json", `[{"id":"QueueLength","type":"gauge","value":3},{"id":"Processed","type":"counter","delta":10}]`)
+	write("broken.prom", "garbage\n")
+	write("notes.txt", "ignored 1\n")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".job.prom.tmp"), []byte("partial"), 0644))
+	mtime := time.Unix(1700000000, 0)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "backup.prom"), mtime, mtime))
+
+	c := NewTextfileCollector(dir)
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	got := metricsByID(batch)
+	assert.Len(t, got, 8)
+	assert.Equal(t, 1700000000.0, *got[`TextfileMtime{file="backup.prom"}`].Value)
+	assert.Equal(t, 0.0, *got[`TextfileError{file="backup.prom"}`].Value)
+	assert.Equal(t, 1.0, *got[`TextfileError{file="broken.prom"}`].Value)
+	assert.Equal(t, 1024.0, *got["backup_size_bytes"].Value)
+	assert.Equal(t, 3.0, *got["QueueLength"].Value)
+	assert.NotContains(t, got, "backup_runs_total")
+
+	assert.NotContains(t, got, "Processed", "files present at start only record their state")
+
+	write("backup.prom", "# TYPE backup_runs_total counter\nbackup_runs_total 6\n")
+	write("queue.json", `[{"id":"Processed","type":"counter","delta":25}]`)
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.Equal(t, int64(1), *got["backup_runs_total"].Delta)
+	assert.Equal(t, int64(25), *got["Processed"].Delta, "json deltas are increments, as in the exec collector")
+
+	batch, err = c.Collect(context.Background())
+	require.NoError(t, err)
+	got = metricsByID(batch)
+	assert.NotContains(t, got, "Processed", "an increment is reported once per written file")
+	assert.Equal(t, int64(0), *got["backup_runs_total"].Delta)
+
+	_, err = NewTextfileCollector(filepath.Join(dir, "missing")).Collect(context.Background())
+	assert.Error(t, err)
+	batch, err = NewTextfileCollector("").Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, batch)
+}
+
+func TestTextfileCollector_SameIDInFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		tmp := filepath.Join(dir, ".tmp")
+		require.NoError(t, os.WriteFile(tmp, []byte(content), 0644))
+		require.NoError(t, os.Rename(tmp, filepath.Join(dir, name)))
+	}
+	write("a.prom", "# TYPE jobs_total counter\njobs_total 100\n")
+	write("b.prom", "# TYPE jobs_total counter\njobs_total 5\n")
+
+	c := NewTextfileCollector(dir)
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	write("a.prom", "# TYPE jobs_total counter\njobs_total 101\n")
+	write("b.prom", "# TYPE jobs_total counter\njobs_total 7\n")
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	var deltas []int64
+	for _, m := range batch {
+		if m.ID == "jobs_total" {
+			deltas = append(deltas, *m.Delta)
+		}
+	}
+	assert.Equal(t, []int64{1, 2}, deltas, "counters are tracked per file")
+}
+
+func TestExecAndTextfileJSONCounters(t *testing.T) {
+	dir := t.TempDir()
+	c := NewTextfileCollector(dir)
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	output := `[{"id":"Processed","type":"counter","delta":4}]`
+	fromExec, err := parseJSONMetrics([]byte(output))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "job.json"), []byte(output), 0644))
+	batch, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, *fromExec[0].Delta, *metricsByID(batch)["Processed"].Delta, "the same output means the same increment")
+}
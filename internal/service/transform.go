@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"path"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// Filter selects metrics by name using glob patterns in the path.Match syntax.
+//
+// A metric passes the filter if its name matches any Include pattern (or Include
+// is empty) and matches no Exclude pattern. Labels of the metric ID are ignored
+// when matching.
+type Filter struct {
+	// Include lists patterns of metric names to keep. Empty means all names.
+	Include []string
+
+	// Exclude lists patterns of metric names to drop.
+	Exclude []string
+}
+
+// Allow reports whether a metric with the given ID passes the filter.
+//
+// Example usage:
+//
+//	f := metrics.Filter{Include: []string{"Heap*"}, Exclude: []string{"HeapReleased"}}
+//	f.Allow("HeapAlloc")    // true
+//	f.Allow("HeapReleased") // false
+func (f Filter) Allow(id string) bool {
+	name, _ := models.SplitLabels(id)
+	if len(f.Include) > 0 && !matchAny(f.Include, name) {
+		return false
+	}
+	return !matchAny(f.Exclude, name)
+}
+
+// Apply returns the metrics passing the filter.
+func (f Filter) Apply(batch []models.Metric) []models.Metric {
+	if len(f.Include) == 0 && len(f.Exclude) == 0 {
+		return batch
+	}
+	res := make([]models.Metric, 0, len(batch))
+	for _, m := range batch {
+		if f.Allow(m.ID) {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Relabeler renames metrics and attaches static labels to them.
+type Relabeler struct {
+	// Rename maps original metric names to new names.
+	Rename map[string]string
+
+	// Labels are added to every metric. Labels set by collectors take precedence.
+	Labels map[string]string
+}
+
+// Apply renames the metrics and adds the static labels in place and returns the batch.
+//
+// Example usage:
+//
+//	r := metrics.Relabeler{Rename: map[string]string{"Alloc": "GoAlloc"}, Labels: map[string]string{"host": "web1"}}
+//	batch = r.Apply(batch) // "Alloc" -> `GoAlloc{host="web1"}`
+func (r Relabeler) Apply(batch []models.Metric) []models.Metric {
+	if len(r.Rename) == 0 && len(r.Labels) == 0 {
+		return batch
+	}
+	for i := range batch {
+		name, labels := models.SplitLabels(batch[i].ID)
+		if renamed, ok := r.Rename[name]; ok {
+			name = renamed
+		}
+		batch[i].ID = models.AddLabels(models.WithLabels(name, labels), r.Labels)
+	}
+	return batch
+}
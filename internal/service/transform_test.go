@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilter_Allow(t *testing.T) {
+	f := Filter{Include: []string{"Heap*", "NumGC"}, Exclude: []string{"HeapReleased"}}
+	assert.True(t, f.Allow("HeapAlloc"))
+	assert.True(t, f.Allow(`NumGC{host="web1"}`))
+	assert.False(t, f.Allow("HeapReleased"))
+	assert.False(t, f.Allow("Alloc"))
+
+	assert.True(t, Filter{}.Allow("Alloc"))
+}
+
+func TestRelabeler_Apply(t *testing.T) {
+	value := 1.0
+	batch := []models.Metric{
+		{ID: "Alloc", MType: models.GaugeMetricName, Value: &value},
+		{ID: `DiskFree{mountpoint="/"}`, MType: models.GaugeMetricName, Value: &value},
+	}
+	r := Relabeler{Rename: map[string]string{"Alloc": "GoAlloc"}, Labels: map[string]string{"host": "web1"}}
+	batch = r.Apply(batch)
+	assert.Equal(t, `GoAlloc{host="web1"}`, batch[0].ID)
+	assert.Equal(t, `DiskFree{host="web1",mountpoint="/"}`, batch[1].ID)
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrBatchApplied is returned by SaveAll of a storage recording applied batches
+// (see ContextWithBatch) for a batch that was applied before. Nothing is saved.
+var ErrBatchApplied = errors.New("batch already applied")
+
+// batchKey is the context key of the batch of a request.
+type batchKey struct{}
+
+// batchID identifies a batch by the sending agent and its sequence number.
+type batchID struct {
+	agentID string
+	seq     uint64
+}
+
+// ContextWithBatch returns a context identifying the batch saved by SaveAll.
+//
+// A storage shared by several servers records the batch in the transaction saving
+// its metrics, so a batch resent to another server after a lost response is not
+// applied twice. Other storages ignore it.
+func ContextWithBatch(ctx context.Context, agentID string, seq uint64) context.Context {
+	return context.WithValue(ctx, batchKey{}, batchID{agentID: agentID, seq: seq})
+}
+
+// batchFromContext returns the batch set by ContextWithBatch.
+func batchFromContext(ctx context.Context) (batchID, bool) {
+	b, ok := ctx.Value(batchKey{}).(batchID)
+	return b, ok
+}
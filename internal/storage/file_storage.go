@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/DenisPavlov/monitoring/internal/logger"
 	"github.com/DenisPavlov/monitoring/internal/models"
@@ -16,7 +19,10 @@ import (
 type FileMetricsStorage struct {
 	*MemoryMetricsStorage
 	filename       string
-	needToSaveSync bool
+	needToSaveSync atomic.Bool
+	// savedAt is the Unix time in nanoseconds of the last successful SaveToFile
+	// or, until then, of the storage creation.
+	savedAt atomic.Int64
 }
 
 // jsonMetrics is an internal struct used for JSON serialization/deserialization
@@ -39,11 +45,13 @@ type jsonMetrics struct {
 //
 //	storage := NewFileStorage(true, "/tmp/metrics.json")
 func NewFileStorage(needToSaveSync bool, filename string) *FileMetricsStorage {
-	return &FileMetricsStorage{
+	storage := &FileMetricsStorage{
 		MemoryMetricsStorage: NewMemStorage(),
-		needToSaveSync:       needToSaveSync,
 		filename:             filename,
 	}
+	storage.needToSaveSync.Store(needToSaveSync)
+	storage.savedAt.Store(time.Now().UnixNano())
+	return storage
 }
 
 // InitFromFile creates a new FileMetricsStorage instance and initializes it
@@ -75,12 +83,13 @@ func InitFromFile(needToSaveSync bool, filename string) (*FileMetricsStorage, er
 		return nil, err
 	}
 
-	storage := FileMetricsStorage{
-		MemoryMetricsStorage: &MemoryMetricsStorage{metrics: jMetrics.Metrics},
-		needToSaveSync:       needToSaveSync,
+	storage := &FileMetricsStorage{
+		MemoryMetricsStorage: newMemStorageFrom(jMetrics.Metrics),
 		filename:             filename,
 	}
-	return &storage, nil
+	storage.needToSaveSync.Store(needToSaveSync)
+	storage.savedAt.Store(time.Now().UnixNano())
+	return storage, nil
 }
 
 // SaveToFile saves the current metrics data to the configured JSON file.
@@ -98,7 +107,7 @@ func InitFromFile(needToSaveSync bool, filename string) (*FileMetricsStorage, er
 //	    log.Error("Failed to save metrics to file:", err)
 //	}
 func (s *FileMetricsStorage) SaveToFile() error {
-	data, err := json.MarshalIndent(jsonMetrics{Metrics: s.metrics}, "", "   ")
+	data, err := json.MarshalIndent(jsonMetrics{Metrics: s.snapshot()}, "", "   ")
 	if err != nil {
 		logger.Log.Error("cannot create byte data from storage", err)
 		return err
@@ -108,7 +117,43 @@ func (s *FileMetricsStorage) SaveToFile() error {
 		logger.Log.Error("cannot save to file", err)
 		return err
 	}
-	return os.WriteFile(s.filename, data, 0666)
+	s.savedAt.Store(time.Now().UnixNano())
+	return nil
+}
+
+// SetSaveSync switches between synchronous saving on each Save operation
+// and saving only on explicit SaveToFile calls.
+func (s *FileMetricsStorage) SetSaveSync(needToSaveSync bool) {
+	s.needToSaveSync.Store(needToSaveSync)
+}
+
+// LastSavedAt returns the time of the last successful SaveToFile call.
+// Before the first save it returns the time the storage was created.
+func (s *FileMetricsStorage) LastSavedAt() time.Time {
+	return time.Unix(0, s.savedAt.Load())
+}
+
+// CheckWritable verifies that the directory of the storage file is writable
+// by creating and removing a temporary file in it.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//
+// Returns:
+//   - error: If the context is cancelled or the temporary file cannot be created
+func (s *FileMetricsStorage) CheckWritable(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.filename), ".healthcheck-*")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
 }
 
 // Save stores a metric in the storage and optionally persists to file.
@@ -141,7 +186,7 @@ func (s *FileMetricsStorage) Save(ctx context.Context, metric *models.Metric) er
 		if err != nil {
 			return err
 		}
-		if s.needToSaveSync {
+		if s.needToSaveSync.Load() {
 			err := s.SaveToFile()
 			if err != nil {
 				return err
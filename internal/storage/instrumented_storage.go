@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/DenisPavlov/monitoring/internal/logger"
+	"github.com/DenisPavlov/monitoring/internal/models"
+)
+
+// SelfMetricsPrefix is the ID prefix of internal metrics describing the server itself.
+// Metrics with this prefix are served from the self-metrics storage instead of the backend
+// and cannot be saved by clients.
+const SelfMetricsPrefix = "server_"
+
+// ErrReservedID is returned by InstrumentedStorage when a metric to save has an ID
+// starting with SelfMetricsPrefix.
+var ErrReservedID = errors.New("metric IDs starting with " + SelfMetricsPrefix + " are reserved for server metrics")
+
+// retryCounterKey is the context key under which the retry counter is stored.
+type retryCounterKey struct{}
+
+// withRetryCounter returns a derived context carrying a retry counter that
+// execWithRetries and queryWithRetries increment on every retryable failure.
+func withRetryCounter(ctx context.Context) (context.Context, *int64) {
+	var retries int64
+	return context.WithValue(ctx, retryCounterKey{}, &retries), &retries
+}
+
+// countRetry increments the retry counter stored in the context, if any.
+func countRetry(ctx context.Context) {
+	if retries, ok := ctx.Value(retryCounterKey{}).(*int64); ok {
+		atomic.AddInt64(retries, 1)
+	}
+}
+
+// InstrumentedStorage is a MetricsStorage decorator that records per-operation
+// latency, error and retry counts of the wrapped storage as self-metrics.
+//
+// Self-metrics are kept in a separate in-memory storage and are merged into
+// read results, so they are available through the regular API.
+//
+// Recorded metrics for every operation (save, save_all, get, get_all):
+//   - server_storage_<op>_total: number of calls (counter)
+//   - server_storage_<op>_errors_total: number of failed calls (counter)
+//   - server_storage_<op>_retries_total: number of retried database attempts (counter)
+//   - server_storage_<op>_duration_us_total: accumulated call duration in microseconds (counter)
+//   - server_storage_<op>_duration_seconds: duration of the last call (gauge)
+type InstrumentedStorage struct {
+	next MetricsStorage
+	self MetricsStorage
+}
+
+// NewInstrumentedStorage wraps the storage with instrumentation.
+//
+// Parameters:
+//   - next: Storage to be instrumented
+//   - self: Storage where self-metrics are recorded
+//
+// Returns:
+//   - *InstrumentedStorage: Instrumented storage instance
+//
+// Example usage:
+//
+//	self := storage.NewMemStorage()
+//	store := storage.NewInstrumentedStorage(storage.NewMemStorage(), self)
+func NewInstrumentedStorage(next, self MetricsStorage) *InstrumentedStorage {
+	return &InstrumentedStorage{next: next, self: self}
+}
+
+// Save stores a single metric in the wrapped storage and records the call.
+// It returns ErrReservedID for an ID starting with SelfMetricsPrefix.
+func (s *InstrumentedStorage) Save(ctx context.Context, metric *models.Metric) error {
+	if strings.HasPrefix(metric.ID, SelfMetricsPrefix) {
+		return ErrReservedID
+	}
+	ctx, retries := withRetryCounter(ctx)
+	start := time.Now()
+	err := s.next.Save(ctx, metric)
+	s.record("save", start, *retries, err)
+	return err
+}
+
+// SaveAll stores multiple metrics in the wrapped storage and records the call.
+// It returns ErrReservedID and saves nothing if an ID starts with SelfMetricsPrefix.
+func (s *InstrumentedStorage) SaveAll(ctx context.Context, metrics []models.Metric) error {
+	for _, m := range metrics {
+		if strings.HasPrefix(m.ID, SelfMetricsPrefix) {
+			return ErrReservedID
+		}
+	}
+	ctx, retries := withRetryCounter(ctx)
+	start := time.Now()
+	err := s.next.SaveAll(ctx, metrics)
+	s.record("save_all", start, *retries, err)
+	return err
+}
+
+// GetByTypeAndID retrieves a metric by its ID and type.
+// Self-metrics are looked up in the self-metrics storage without being recorded.
+func (s *InstrumentedStorage) GetByTypeAndID(ctx context.Context, id, mType string) (models.Metric, error) {
+	if strings.HasPrefix(id, SelfMetricsPrefix) {
+		return s.self.GetByTypeAndID(ctx, id, mType)
+	}
+	ctx, retries := withRetryCounter(ctx)
+	start := time.Now()
+	res, err := s.next.GetByTypeAndID(ctx, id, mType)
+	s.record("get", start, *retries, err)
+	return res, err
+}
+
+// GetAllByType retrieves all metrics of a specific type from the wrapped storage
+// followed by the self-metrics of the same type. Metrics of the wrapped storage with
+// reserved IDs, saved before it was instrumented, are left out, so every ID appears once.
+func (s *InstrumentedStorage) GetAllByType(ctx context.Context, mType string) ([]models.Metric, error) {
+	ctx, retries := withRetryCounter(ctx)
+	start := time.Now()
+	res, err := s.next.GetAllByType(ctx, mType)
+	s.record("get_all", start, *retries, err)
+	if err != nil {
+		return nil, err
+	}
+
+	self, err := s.self.GetAllByType(ctx, mType)
+	if err != nil {
+		return nil, err
+	}
+	merged := make([]models.Metric, 0, len(res)+len(self))
+	for _, m := range res {
+		if !strings.HasPrefix(m.ID, SelfMetricsPrefix) {
+			merged = append(merged, m)
+		}
+	}
+	return append(merged, self...), nil
+}
+
+// record saves the self-metrics describing a single storage call.
+func (s *InstrumentedStorage) record(op string, start time.Time, retries int64, err error) {
+	elapsed := time.Since(start)
+	prefix := SelfMetricsPrefix + "storage_" + op
+	var failed int64
+	if err != nil && !errors.Is(err, ErrBatchApplied) {
+		failed = 1
+	}
+	batch := []models.Metric{
+		counterMetric(prefix+"_total", 1),
+		counterMetric(prefix+"_errors_total", failed),
+		counterMetric(prefix+"_retries_total", retries),
+		counterMetric(prefix+"_duration_us_total", elapsed.Microseconds()),
+		gaugeMetric(prefix+"_duration_seconds", elapsed.Seconds()),
+	}
+	if err := s.self.SaveAll(context.Background(), batch); err != nil {
+		logger.Log.Errorf("cannot record storage self-metrics: %v", err)
+	}
+}
+
+// counterMetric creates a counter metric with the given ID and delta.
+func counterMetric(id string, delta int64) models.Metric {
+	return models.Metric{ID: id, MType: models.CounterMetricName, Delta: &delta}
+}
+
+// gaugeMetric creates a gauge metric with the given ID and value.
+func gaugeMetric(id string, value float64) models.Metric {
+	return models.Metric{ID: id, MType: models.GaugeMetricName, Value: &value}
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DenisPavlov/monitoring/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstrumentedStorage_RecordsOperations(t *testing.T) {
+	ctx := context.Background()
+	self := NewMemStorage()
+	s := NewInstrumentedStorage(NewMemStorage(), self)
+
+	value := 1.5
+	assert.NoError(t, s.Save(ctx, &models.Metric{ID: "g1", MType: models.GaugeMetricName, Value: &value}))
+	assert.Error(t, s.Save(ctx, &models.Metric{MType: models.GaugeMetricName, Value: &value}))
+
+	total, err := s.GetByTypeAndID(ctx, "server_storage_save_total", models.CounterMetricName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), *total.Delta)
+
+	errors, err := s.GetByTypeAndID(ctx, "server_storage_save_errors_total", models.CounterMetricName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), *errors.Delta)
+
+	gauges, err := s.GetAllByType(ctx, models.GaugeMetricName)
+	assert.NoError(t, err)
+	var ids []string
+	for _, g := range gauges {
+		ids = append(ids, g.ID)
+	}
+	assert.Contains(t, ids, "g1")
+	assert.Contains(t, ids, "server_storage_save_duration_seconds")
+}
+
+func TestInstrumentedStorage_ReservedIDs(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemStorage()
+	value := 2.0
+	assert.NoError(t, backend.Save(ctx, &models.Metric{ID: "server_old", MType: models.GaugeMetricName, Value: &value}))
+	s := NewInstrumentedStorage(backend, NewMemStorage())
+
+	assert.ErrorIs(t, s.Save(ctx, &models.Metric{ID: "server_xyz", MType: models.GaugeMetricName, Value: &value}), ErrReservedID)
+	assert.ErrorIs(t, s.SaveAll(ctx, []models.Metric{
+		{ID: "g1", MType: models.GaugeMetricName, Value: &value},
+		{ID: "server_xyz", MType: models.GaugeMetricName, Value: &value},
+	}), ErrReservedID)
+	assert.NoError(t, s.Save(ctx, &models.Metric{ID: "g2", MType: models.GaugeMetricName, Value: &value}))
+
+	gauges, err := s.GetAllByType(ctx, models.GaugeMetricName)
+	assert.NoError(t, err)
+	seen := make(map[string]bool)
+	for _, g := range gauges {
+		assert.False(t, seen[g.ID], "ID %s is listed twice", g.ID)
+		seen[g.ID] = true
+	}
+	assert.True(t, seen["g2"])
+	assert.False(t, seen["g1"], "a batch with a reserved ID is not saved")
+	assert.False(t, seen["server_old"], "reserved IDs of the backend are not listed")
+}
+
+func TestCountRetry(t *testing.T) {
+	ctx, retries := withRetryCounter(context.Background())
+	countRetry(ctx)
+	countRetry(ctx)
+	countRetry(context.Background())
+	assert.Equal(t, int64(2), *retries)
+}
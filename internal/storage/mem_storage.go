@@ -3,20 +3,31 @@ package storage
 import (
 	"context"
 	"errors"
-	"reflect"
+	"hash/fnv"
+	"sort"
 	"sync"
 
 	"github.com/DenisPavlov/monitoring/internal/models"
 )
 
-// MemoryMetricsStorage implements in-memory storage for metrics using a thread-safe map.
-// It provides basic CRUD operations for metrics with proper concurrency control.
-type MemoryMetricsStorage struct {
+// shardCount defines the number of independent shards the in-memory storage
+// is split into. Metrics are distributed across shards by the hash of their key.
+const shardCount = 32
+
+// shard is a single partition of the in-memory storage guarded by its own lock.
+type shard struct {
 	metrics map[string]models.Metric
-	mu      sync.Mutex
+	mu      sync.RWMutex
 }
 
-// NewMemStorage creates a new instance of MemoryMetricsStorage with an empty metrics map.
+// MemoryMetricsStorage implements in-memory storage for metrics using a sharded map.
+// Each shard is protected by its own sync.RWMutex, so readers do not block each other
+// and writers only block the shards they touch.
+type MemoryMetricsStorage struct {
+	shards [shardCount]*shard
+}
+
+// NewMemStorage creates a new instance of MemoryMetricsStorage with empty shards.
 //
 // Returns:
 //   - *MemoryMetricsStorage: New in-memory storage instance
@@ -25,9 +36,21 @@ type MemoryMetricsStorage struct {
 //
 //	storage := NewMemStorage()
 func NewMemStorage() *MemoryMetricsStorage {
-	return &MemoryMetricsStorage{
-		metrics: make(map[string]models.Metric),
+	s := &MemoryMetricsStorage{}
+	for i := range s.shards {
+		s.shards[i] = &shard{metrics: make(map[string]models.Metric)}
+	}
+	return s
+}
+
+// newMemStorageFrom creates a new MemoryMetricsStorage and distributes the given
+// metrics, indexed by their storage key, across the shards.
+func newMemStorageFrom(metrics map[string]models.Metric) *MemoryMetricsStorage {
+	s := NewMemStorage()
+	for k, m := range metrics {
+		s.shardFor(k).metrics[k] = m
 	}
+	return s
 }
 
 // Save stores a metric in the in-memory storage with proper concurrency control.
@@ -43,7 +66,7 @@ func NewMemStorage() *MemoryMetricsStorage {
 // Behavior:
 //   - For gauge metrics: Replaces existing value
 //   - For counter metrics: Increments existing value (adds to current delta)
-//   - Thread-safe: Uses mutex locking for concurrent access
+//   - Thread-safe: Locks only the shard owning the metric
 //
 // Example usage:
 //
@@ -61,34 +84,26 @@ func (s *MemoryMetricsStorage) Save(ctx context.Context, metric *models.Metric)
 		if err != nil {
 			return err
 		}
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		switch metric.MType {
-		case models.GaugeMetricName:
-			s.metrics[key] = *metric
-		case models.CounterMetricName:
-			m, err := s.getByTypeAndID(metric.ID, models.CounterMetricName)
-			if err != nil {
-				return err
-			}
-			if !reflect.DeepEqual(m, models.Metric{}) {
-				*metric.Delta = *metric.Delta + *m.Delta
-			}
-			s.metrics[key] = *metric
-		}
+		sh := s.shardFor(key)
+		sh.mu.Lock()
+		defer sh.mu.Unlock()
+		sh.save(key, metric)
 		return nil
 	}
 }
 
 // SaveAll stores multiple metrics in the storage atomically.
-// If any metric fails to save, the entire operation fails.
+// If any metric fails validation, nothing is saved.
+//
+// All shards touched by the batch are write-locked in a fixed order before any
+// metric is applied, so concurrent readers observe either the whole batch or none of it.
 //
 // Parameters:
 //   - ctx: Context for cancellation and timeout
 //   - metrics: Slice of Metric objects to be saved
 //
 // Returns:
-//   - error: If context is cancelled or any metric save operation fails
+//   - error: If context is cancelled or any metric fails validation
 //
 // Example usage:
 //
@@ -99,11 +114,33 @@ func (s *MemoryMetricsStorage) SaveAll(ctx context.Context, metrics []models.Met
 	case <-ctx.Done():
 		return ctx.Err()
 	default:
-		for _, metric := range metrics {
-			err := s.Save(ctx, &metric)
+		keys := make([]string, len(metrics))
+		touched := make(map[int]struct{})
+		for i, metric := range metrics {
+			k, err := key(metric)
 			if err != nil {
 				return err
 			}
+			keys[i] = k
+			touched[shardIndex(k)] = struct{}{}
+		}
+
+		indexes := make([]int, 0, len(touched))
+		for i := range touched {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		for _, i := range indexes {
+			s.shards[i].mu.Lock()
+		}
+		defer func() {
+			for _, i := range indexes {
+				s.shards[i].mu.Unlock()
+			}
+		}()
+
+		for i := range metrics {
+			s.shardFor(keys[i]).save(keys[i], &metrics[i])
 		}
 		return nil
 	}
@@ -128,32 +165,22 @@ func (s *MemoryMetricsStorage) GetByTypeAndID(ctx context.Context, id, mType str
 	case <-ctx.Done():
 		return res, ctx.Err()
 	default:
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		return s.getByTypeAndID(id, mType)
-	}
-}
-
-// getByTypeAndID is an internal method to retrieve a metric by ID and type.
-// Must be called with mutex already locked.
-//
-// Parameters:
-//   - id: Metric identifier name
-//   - mType: Metric type ("gauge" or "counter")
-//
-// Returns:
-//   - models.Metric: Found metric or empty Metric if not found
-//   - error: If metric validation fails
-func (s *MemoryMetricsStorage) getByTypeAndID(id, mType string) (res models.Metric, err error) {
-	key, err := key(models.Metric{ID: id, MType: mType})
-	if err != nil {
-		return res, err
+		key, err := key(models.Metric{ID: id, MType: mType})
+		if err != nil {
+			return res, err
+		}
+		sh := s.shardFor(key)
+		sh.mu.RLock()
+		defer sh.mu.RUnlock()
+		return sh.metrics[key], nil
 	}
-	return s.metrics[key], nil
 }
 
 // GetAllByType retrieves all metrics of a specific type.
 //
+// All shards are read-locked for the duration of the scan, which keeps the result
+// consistent with SaveAll while still allowing other readers to proceed.
+//
 // Parameters:
 //   - ctx: Context for cancellation and timeout
 //   - mType: Metric type to filter by ("gauge" or "counter")
@@ -171,17 +198,73 @@ func (s *MemoryMetricsStorage) GetAllByType(ctx context.Context, mType string) (
 	case <-ctx.Done():
 		return res, ctx.Err()
 	default:
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		for _, metric := range s.metrics {
-			if metric.MType == mType {
-				res = append(res, metric)
+		s.rLockAll()
+		defer s.rUnlockAll()
+		for _, sh := range s.shards {
+			for _, metric := range sh.metrics {
+				if metric.MType == mType {
+					res = append(res, metric)
+				}
 			}
 		}
 		return res, nil
 	}
 }
 
+// snapshot returns a consistent copy of all stored metrics indexed by their storage key.
+func (s *MemoryMetricsStorage) snapshot() map[string]models.Metric {
+	s.rLockAll()
+	defer s.rUnlockAll()
+	res := make(map[string]models.Metric)
+	for _, sh := range s.shards {
+		for k, m := range sh.metrics {
+			res[k] = m
+		}
+	}
+	return res
+}
+
+func (s *MemoryMetricsStorage) rLockAll() {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+}
+
+func (s *MemoryMetricsStorage) rUnlockAll() {
+	for _, sh := range s.shards {
+		sh.mu.RUnlock()
+	}
+}
+
+// shardFor returns the shard responsible for the given storage key.
+func (s *MemoryMetricsStorage) shardFor(key string) *shard {
+	return s.shards[shardIndex(key)]
+}
+
+// save applies a metric to the shard. Must be called with the shard write lock held.
+//
+// Behavior:
+//   - For gauge metrics: Replaces existing value
+//   - For counter metrics: Adds the existing delta to the incoming one before storing it
+func (sh *shard) save(key string, metric *models.Metric) {
+	switch metric.MType {
+	case models.GaugeMetricName:
+		sh.metrics[key] = *metric
+	case models.CounterMetricName:
+		if m, ok := sh.metrics[key]; ok && m.Delta != nil {
+			*metric.Delta = *metric.Delta + *m.Delta
+		}
+		sh.metrics[key] = *metric
+	}
+}
+
+// shardIndex hashes a storage key with FNV-1a and maps it onto a shard index.
+func shardIndex(key string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % shardCount)
+}
+
 // key generates a unique storage key for a metric based on ID and type.
 //
 // Parameters:
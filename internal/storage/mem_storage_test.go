@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"strconv"
 	"testing"
 
 	"github.com/DenisPavlov/monitoring/internal/models"
@@ -36,3 +37,137 @@ func TestMemStorage_Add(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, int64(2), *actual.Delta)
 }
+
+func TestMemStorage_SaveAll(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	gValue := 1.5
+	cValue1 := int64(2)
+	cValue2 := int64(3)
+	err := s.SaveAll(ctx, []models.Metric{
+		{ID: "g1", MType: models.GaugeMetricName, Value: &gValue},
+		{ID: "c1", MType: models.CounterMetricName, Delta: &cValue1},
+		{ID: "c1", MType: models.CounterMetricName, Delta: &cValue2},
+	})
+	assert.NoError(t, err)
+
+	gauge, err := s.GetByTypeAndID(ctx, "g1", models.GaugeMetricName)
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, *gauge.Value)
+
+	counter, err := s.GetByTypeAndID(ctx, "c1", models.CounterMetricName)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), *counter.Delta)
+}
+
+func TestMemStorage_SaveAllInvalid(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	gValue := 1.5
+	err := s.SaveAll(ctx, []models.Metric{
+		{ID: "g1", MType: models.GaugeMetricName, Value: &gValue},
+		{ID: "", MType: models.GaugeMetricName, Value: &gValue},
+	})
+	assert.Error(t, err)
+
+	gauges, err := s.GetAllByType(ctx, models.GaugeMetricName)
+	assert.NoError(t, err)
+	assert.Empty(t, gauges)
+}
+
+func TestMemStorage_SaveAllAtomicForReaders(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemStorage()
+
+	const batchSize = 64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			batch := make([]models.Metric, batchSize)
+			for j := range batch {
+				v := float64(i)
+				batch[j] = models.Metric{ID: "g" + strconv.Itoa(j), MType: models.GaugeMetricName, Value: &v}
+			}
+			assert.NoError(t, s.SaveAll(ctx, batch))
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			gauges, err := s.GetAllByType(ctx, models.GaugeMetricName)
+			assert.NoError(t, err)
+			if len(gauges) == 0 {
+				continue
+			}
+			assert.Len(t, gauges, batchSize)
+			for _, g := range gauges {
+				assert.Equal(t, *gauges[0].Value, *g.Value, "reader observed a partially applied batch")
+			}
+		}
+	}
+}
+
+func BenchmarkMemStorage_SaveAllParallel(b *testing.B) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	batch := benchBatch(40)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := s.SaveAll(ctx, cloneBatch(batch)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMemStorage_MixedParallel(b *testing.B) {
+	ctx := context.Background()
+	s := NewMemStorage()
+	batch := benchBatch(40)
+	_ = s.SaveAll(ctx, cloneBatch(batch))
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			var err error
+			if i%4 == 0 {
+				_, err = s.GetAllByType(ctx, models.GaugeMetricName)
+			} else {
+				err = s.SaveAll(ctx, cloneBatch(batch))
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func benchBatch(n int) []models.Metric {
+	batch := make([]models.Metric, 0, n+1)
+	for i := 0; i < n; i++ {
+		v := float64(i)
+		batch = append(batch, models.Metric{ID: "gauge" + strconv.Itoa(i), MType: models.GaugeMetricName, Value: &v})
+	}
+	d := int64(1)
+	return append(batch, models.Metric{ID: "PollCount", MType: models.CounterMetricName, Delta: &d})
+}
+
+func cloneBatch(batch []models.Metric) []models.Metric {
+	res := make([]models.Metric, len(batch))
+	for i, m := range batch {
+		res[i] = m
+		if m.Delta != nil {
+			d := *m.Delta
+			res[i].Delta = &d
+		}
+	}
+	return res
+}
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/DenisPavlov/monitoring/internal/idempotency"
 	"github.com/DenisPavlov/monitoring/internal/models"
 	"github.com/DenisPavlov/monitoring/internal/util"
 
@@ -41,6 +42,17 @@ func NewPostgresStorage(db *sql.DB) (*PostgresMetricsStorage, error) {
 	return &PostgresMetricsStorage{db: db}, nil
 }
 
+// Ping verifies that the database is reachable.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout
+//
+// Returns:
+//   - error: If the database cannot be reached
+func (s *PostgresMetricsStorage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
 // InitSchema initializes the database schema by creating the metrics table
 // if it doesn't already exist.
 //
@@ -55,8 +67,10 @@ func NewPostgresStorage(db *sql.DB) (*PostgresMetricsStorage, error) {
 //   - type: TEXT (metric type: "gauge" or "counter")
 //   - delta: BIGINT (counter value, nullable)
 //   - value: DOUBLE PRECISION (gauge value, nullable)
+//
+// The applied_batches table holds the batches recorded by SaveAll (see ContextWithBatch).
 func (s *PostgresMetricsStorage) InitSchema(ctx context.Context) error {
-	return execWithRetries(func() error {
+	return execWithRetries(ctx, func() error {
 		_, err := s.db.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS metrics (
 		    id TEXT PRIMARY KEY,
@@ -67,7 +81,14 @@ func (s *PostgresMetricsStorage) InitSchema(ctx context.Context) error {
 		if err != nil {
 			return err
 		}
-		return nil
+		_, err = s.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS applied_batches (
+		    agent_id TEXT NOT NULL,
+		    seq BIGINT NOT NULL,
+		    created_at TIMESTAMPTZ NOT NULL,
+		    PRIMARY KEY (agent_id, seq))`,
+		)
+		return err
 	})
 }
 
@@ -86,7 +107,7 @@ func (s *PostgresMetricsStorage) InitSchema(ctx context.Context) error {
 //   - For counter metrics: Increments existing value (INSERT ON CONFLICT UPDATE with delta addition)
 //   - Automatic retry on transient connection errors
 func (s *PostgresMetricsStorage) Save(ctx context.Context, metric *models.Metric) error {
-	return execWithRetries(func() error {
+	return execWithRetries(ctx, func() error {
 		tx, err := s.db.Begin()
 		if err != nil {
 			return err
@@ -97,6 +118,9 @@ func (s *PostgresMetricsStorage) Save(ctx context.Context, metric *models.Metric
 		if err != nil {
 			return err
 		}
+		if err := idempotency.CompleteInTx(ctx, tx); err != nil {
+			return err
+		}
 		return tx.Commit()
 	})
 }
@@ -143,25 +167,70 @@ func saveOne(ctx context.Context, metric *models.Metric, tx *sql.Tx) error {
 // Returns:
 //   - error: If any save operation fails after all retry attempts
 //
-// The operation is atomic - either all metrics are saved or none are.
+// The operation is atomic - either all metrics are saved or none are. The idempotency
+// key of the request, if any (see idempotency.ContextWithKey), is completed in the
+// same transaction. The batch of the request, if any (see ContextWithBatch), is
+// recorded in it too; ErrBatchApplied is returned if it was recorded before.
 func (s *PostgresMetricsStorage) SaveAll(ctx context.Context, metrics []models.Metric) error {
-	return execWithRetries(func() error {
+	return execWithRetries(ctx, func() error {
 		tx, err := s.db.Begin()
 		if err != nil {
 			return err
 		}
 		defer tx.Rollback()
 
+		if err := recordBatch(ctx, tx); err != nil {
+			return err
+		}
+
 		for _, metric := range metrics {
 			err := saveOne(ctx, &metric, tx)
 			if err != nil {
 				return err
 			}
 		}
+		if err := idempotency.CompleteInTx(ctx, tx); err != nil {
+			return err
+		}
 		return tx.Commit()
 	})
 }
 
+// recordBatch records the batch of the request in tx. It returns ErrBatchApplied if
+// the batch is recorded already; a concurrent transaction recording the same batch
+// blocks until the first one ends.
+func recordBatch(ctx context.Context, tx *sql.Tx) error {
+	batch, ok := batchFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO applied_batches (agent_id, seq, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`,
+		batch.agentID, int64(batch.seq), time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBatchApplied
+	}
+	return nil
+}
+
+// DeleteAppliedBatches removes the batches recorded more than ttl ago. It should be
+// called periodically to keep the applied_batches table small.
+func (s *PostgresMetricsStorage) DeleteAppliedBatches(ctx context.Context, ttl time.Duration) error {
+	return execWithRetries(ctx, func() error {
+		_, err := s.db.ExecContext(ctx, `DELETE FROM applied_batches WHERE created_at < $1`, time.Now().Add(-ttl))
+		return err
+	})
+}
+
 // GetByTypeAndID retrieves a specific metric by its ID and type with retry logic.
 //
 // Parameters:
@@ -175,7 +244,7 @@ func (s *PostgresMetricsStorage) SaveAll(ctx context.Context, metrics []models.M
 //
 // Note: Returns empty Metric without error if no matching record is found.
 func (s *PostgresMetricsStorage) GetByTypeAndID(ctx context.Context, id, mType string) (metric models.Metric, err error) {
-	return queryWithRetries(func() (models.Metric, error) {
+	return queryWithRetries(ctx, func() (models.Metric, error) {
 		row := s.db.QueryRowContext(ctx, `SELECT id, type, delta, value FROM metrics WHERE id = $1 AND type = $2`, id, mType)
 		if err = row.Scan(&metric.ID, &metric.MType, &metric.Delta, &metric.Value); err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
@@ -199,7 +268,7 @@ func (s *PostgresMetricsStorage) GetByTypeAndID(ctx context.Context, id, mType s
 //
 // Uses COALESCE to ensure non-null values for delta and value fields.
 func (s *PostgresMetricsStorage) GetAllByType(ctx context.Context, mType string) ([]models.Metric, error) {
-	return queryWithRetries(func() ([]models.Metric, error) {
+	return queryWithRetries(ctx, func() ([]models.Metric, error) {
 		rows, err := s.db.QueryContext(ctx, `SELECT id, type, COALESCE(delta, 0), COALESCE(value,0) FROM metrics WHERE type = $1`, mType)
 		if err != nil {
 			return nil, err
@@ -250,6 +319,7 @@ func shouldRetry(err error) bool {
 // for transient connection errors.
 //
 // Parameters:
+//   - ctx: Context carrying an optional retry counter (see withRetryCounter)
 //   - action: Function that performs the database query and returns result
 //
 // Returns:
@@ -257,10 +327,11 @@ func shouldRetry(err error) bool {
 //   - error: Final error after all retry attempts
 //
 // Uses exponential backoff between retry attempts.
-func queryWithRetries[T any](action func() (T, error)) (result T, err error) {
+func queryWithRetries[T any](ctx context.Context, action func() (T, error)) (result T, err error) {
 	for i := 0; i < attempts; i++ {
 		result, err = action()
 		if shouldRetry(err) {
+			countRetry(ctx)
 			time.Sleep(util.Backoff(i))
 		} else {
 			return result, err
@@ -273,16 +344,18 @@ func queryWithRetries[T any](action func() (T, error)) (result T, err error) {
 // for transient connection errors.
 //
 // Parameters:
+//   - ctx: Context carrying an optional retry counter (see withRetryCounter)
 //   - action: Function that performs the database operation
 //
 // Returns:
 //   - error: Final error after all retry attempts
 //
 // Uses exponential backoff between retry attempts.
-func execWithRetries(action func() error) (err error) {
+func execWithRetries(ctx context.Context, action func() error) (err error) {
 	for i := 0; i < attempts; i++ {
 		err = action()
 		if shouldRetry(err) {
+			countRetry(ctx)
 			time.Sleep(util.Backoff(i))
 		} else {
 			return err
@@ -0,0 +1,21 @@
+package util
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// ValidateAddress checks that addr is a valid "host:port" address with a port
+// between 1 and 65535. The host part may be empty.
+func ValidateAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("invalid address %q: port must be a number between 1 and 65535", addr)
+	}
+	return nil
+}
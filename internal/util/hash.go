@@ -3,7 +3,9 @@ package util
 import (
 	"crypto/hmac"
 	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
 )
 
 func GetHexSHA256(key string, value []byte) string {
@@ -11,3 +13,13 @@ func GetHexSHA256(key string, value []byte) string {
 	h.Write(value)
 	return fmt.Sprintf("%x", h.Sum(nil))
 }
+
+// GetHexSHA256Request returns the hex HMAC-SHA256 of a request in the signing scheme
+// version 2. Unlike GetHexSHA256 of the body alone, it covers the method, the path
+// with the query, the unix timestamp in seconds and the nonce, so a captured request
+// cannot be sent to another endpoint or replayed after the server forgets the nonce.
+func GetHexSHA256Request(key, method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{"v2", method, path, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")
+	return GetHexSHA256(key, []byte(canonical))
+}